@@ -4,7 +4,6 @@
 package ansi
 
 import (
-	"fmt"
 	"strings"
 )
 
@@ -38,7 +37,21 @@ const (
 	White
 )
 
-// ANSI holds info about an escape. Content is stored in memory accessible by function
+// bright variants, aixterm codes supported by about any terminal
+const (
+	BrightBlack int = iota + 90
+	BrightRed
+	BrightGreen
+	BrightYellow
+	BrightBlue
+	BrightMagenta
+	BrightCyan
+	BrightWhite
+)
+
+// ANSI holds info about an escape. Content is stored in memory accessible by function.
+// Code and Bgcode are only set for the basic and bright colors, extended colors
+// (256 palette, RGB) and styles only have their escapes
 type colorSet struct {
 	Code    int
 	Str     string
@@ -46,22 +59,14 @@ type colorSet struct {
 	Bgcode  int
 	Bgstr   string
 	BgBytes []byte
+	fg, bg  color // what the escapes were built from, to downgrade them
+	attrs   []int // SGR attributes (bold, underline...) preceding the color
 }
 
 func initColor(c int) colorSet {
-	intStr := func(c int) string {
-		return fmt.Sprintf("%d", c)
-	}
-	esc, bgesc := EscapePrefix+intStr(c)+"m", EscapePrefix+intStr(c+10)+"m"
-	escB, bgescB := []byte(esc), []byte(bgesc)
-	return colorSet{
-		Code:    c,
-		Str:     esc,
-		Bytes:   escB,
-		Bgcode:  c + 10, // background
-		Bgstr:   bgesc,
-		BgBytes: bgescB,
-	}
+	cs := colorSet{fg: basicColor(c)}
+	cs.build()
+	return cs
 }
 
 var (
@@ -75,6 +80,15 @@ var (
 		"Magenta": initColor(Magenta),
 		"Cyan":    initColor(Cyan),
 		"White":   initColor(White),
+
+		"BrightBlack":   initColor(BrightBlack),
+		"BrightRed":     initColor(BrightRed),
+		"BrightGreen":   initColor(BrightGreen),
+		"BrightYellow":  initColor(BrightYellow),
+		"BrightBlue":    initColor(BrightBlue),
+		"BrightMagenta": initColor(BrightMagenta),
+		"BrightCyan":    initColor(BrightCyan),
+		"BrightWhite":   initColor(BrightWhite),
 	}
 	// Controls exports some other strings/bytes
 	Controls = map[string]ansiSet{
@@ -131,14 +145,18 @@ func GetColor(color string) colorSet {
 }
 
 // PaintStrings accepts strings and returns a colored string ready to be printed.
-// Bg is for background
+// Bg is for background. Without strings, only the escape starting the color is returned.
+// See Style for more than a color
 func PaintStrings(color string, bg bool, sep string, s ...string) string {
 	if ansi := GetColor(color); ansi.Str != `` {
-		all := strings.Join(s, sep)
+		esc, reset := ansi.Str, Controls["Reset"].Str
 		if bg {
-			return ansi.Bgstr + all + Controls["Reset"].Str
+			esc = ansi.Bgstr
+		}
+		if len(s) == 0 {
+			return esc
 		}
-		return ansi.Str + all + Controls["Reset"].Str
+		return esc + strings.Join(s, sep) + reset
 	}
 	return ``
 }
@@ -4,6 +4,7 @@
 package ansi
 
 import (
+	"strings"
 	"testing"
 )
 
@@ -47,4 +48,142 @@ func TestPaintText(t *testing.T) {
 		t.Logf("%s", PaintStrings(color, true, " ", "this is background ", color))
 		t.Logf("%s", Controls["Reset"].Str)
 	}
+	for _, c := range []struct {
+		bg   bool
+		s    []string
+		want string
+	}{
+		{false, []string{"a", "b"}, "\033[31ma b\033[0m"},
+		{true, []string{"a"}, "\033[41ma\033[0m"},
+		{false, nil, "\033[31m"},
+		{true, nil, "\033[41m"},
+	} {
+		if have := PaintStrings("Red", c.bg, " ", c.s...); have != c.want {
+			t.Errorf("PaintStrings(Red, %v, %q): %q, want %q", c.bg, c.s, have, c.want)
+		}
+	}
+}
+
+func TestParseColor(t *testing.T) {
+	var tests = []struct {
+		spec, fg, bg string
+	}{
+		{"Red", "\033[31m", "\033[41m"},
+		{"brightblue", "\033[94m", "\033[104m"},
+		{"208", "\033[38;5;208m", "\033[48;5;208m"},
+		{"#ff8800", "\033[38;2;255;136;0m", "\033[48;2;255;136;0m"},
+		{"#f80", "\033[38;2;255;136;0m", "\033[48;2;255;136;0m"},
+		{"bold+underline+Red", "\033[1;4;31m", "\033[1;4;41m"},
+		{"Yellow+bgBlue", "\033[33;44m", "\033[43m"},
+	}
+	for _, test := range tests {
+		c, err := ParseColor(test.spec)
+		if err != nil {
+			t.Errorf("%s: %s", test.spec, err)
+			continue
+		}
+		if c.Str != test.fg || c.Bgstr != test.bg {
+			t.Errorf("%s: unexpected escapes %q %q", test.spec, c.Str, c.Bgstr)
+		}
+	}
+	for _, spec := range []string{"Antimatter", "256", "#ff88", "Red+Blue"} {
+		if _, err := ParseColor(spec); err == nil {
+			t.Errorf("Expected an error for %q", spec)
+		}
+	}
+}
+
+func TestDowngrade(t *testing.T) {
+	orange := RGB(255, 136, 0)
+	if s := orange.Downgrade(TrueColor).Str; s != orange.Str {
+		t.Errorf("Unexpected truecolor escape %q", s)
+	}
+	if s := orange.Downgrade(ANSI256).Str; s != "\033[38;5;208m" {
+		t.Errorf("Unexpected 256 colors escape %q", s)
+	}
+	if s := orange.Downgrade(ANSI).Str; s != Colors["Yellow"].Str {
+		t.Errorf("Unexpected basic escape %q", s)
+	}
+	if s := Color256(196).Downgrade(ANSI).Str; s != Colors["BrightRed"].Str {
+		t.Errorf("Unexpected basic escape %q", s)
+	}
+	if s := Colors["Red"].Downgrade(NoColor).Str; s != "" {
+		t.Errorf("Unexpected escape without colors %q", s)
+	}
+}
+
+func TestStrip(t *testing.T) {
+	colored := Colors["Red"].Str + "red" + Controls["Reset"].Str + " \033]8;;http://example.com\033\\link\033]8;;\a \033]0;title\a\033[2Jdone"
+	want := "red link done"
+	if have := StripString(colored); have != want {
+		t.Errorf("Unexpected stripped string %q", have)
+	}
+	var buf strings.Builder
+	w := NewStripWriter(&buf)
+	for i := 0; i < len(colored); i += 3 { // split sequences across writes
+		end := i + 3
+		if end > len(colored) {
+			end = len(colored)
+		}
+		if n, err := w.Write([]byte(colored[i:end])); err != nil || n != end-i {
+			t.Fatalf("Write returned %d, %v", n, err)
+		}
+	}
+	if have := buf.String(); have != want {
+		t.Errorf("Unexpected stripped stream %q", have)
+	}
+}
+
+func TestWidth(t *testing.T) {
+	var tests = []struct {
+		s     string
+		width int
+	}{
+		{"plain", 5},
+		{PaintStrings("Red", false, "", "red"), 3},
+		{"😭", 2},
+		{"⚠️", 2},
+		{"⚠", 1},
+		{"👍🏽", 2},
+		{"👩‍💻", 2},
+		{"🇮🇹🇫🇷", 4},
+		{"日本語", 6},
+		{"é", 1},
+	}
+	for _, test := range tests {
+		if w := Width(test.s); w != test.width {
+			t.Errorf("Width(%q) = %d, want %d", test.s, w, test.width)
+		}
+		if w := WidthBytes([]byte(test.s)); w != test.width {
+			t.Errorf("WidthBytes(%q) = %d, want %d", test.s, w, test.width)
+		}
+	}
+}
+
+func TestStyle(t *testing.T) {
+	reset := Controls["Reset"].Str
+	red := Style{FG: Colors["Red"], Bold: true}
+	blue := Style{FG: Colors["Blue"], BG: Colors["White"], Underline: true}
+	if have, want := red.Sprint("a"), "\033[1;31ma"+reset; have != want {
+		t.Errorf("Unexpected style %q", have)
+	}
+	nested := red.Wrap("outer " + blue.Wrap("inner") + " outer")
+	want := "\033[1;31mouter \033[4;34;47minner" + reset + "\033[1;31m outer" + reset
+	if nested != want {
+		t.Errorf("Unexpected nested style\n%q\n%q", nested, want)
+	}
+	if StripString(nested) != "outer inner outer" {
+		t.Errorf("Unexpected text %q", StripString(nested))
+	}
+	linked := Style{Link: "https://example.com"}.Wrap("site")
+	if linked != Link("https://example.com", "site") {
+		t.Errorf("Unexpected link %q", linked)
+	}
+	var buf strings.Builder
+	if _, err := red.WriteTo(&buf); err != nil || buf.String() != red.String() {
+		t.Errorf("Unexpected WriteTo %q, %v", buf.String(), err)
+	}
+	if (Style{}).Wrap("plain") != "plain" {
+		t.Errorf("The zero Style should not paint")
+	}
 }
@@ -0,0 +1,316 @@
+// COPYRIGHT (c) 2019-2021 SILVANO ZAMPARDI, ALL RIGHTS RESERVED.
+// The license for these sources can be found in the LICENSE file in the root directory of this source tree.
+
+package ansi
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// Color is a color, or a combination of a color with attributes, ready to be printed.
+// Get one from Colors, GetColor, Color256, RGB, Hex or ParseColor
+type Color = colorSet
+
+type colorKind uint8
+
+const (
+	kindNone colorKind = iota
+	kindBasic
+	kind256
+	kindRGB
+)
+
+// color is a single foreground color: an SGR code (30-37, 90-97), a palette index or RGB
+type color struct {
+	kind    colorKind
+	code    int
+	r, g, b uint8
+}
+
+func basicColor(code int) color {
+	return color{kind: kindBasic, code: code}
+}
+
+// SGR parameters of the color as foreground or background
+func (c color) sgr(bg bool) string {
+	switch c.kind {
+	case kindBasic:
+		if bg {
+			return strconv.Itoa(c.code + 10)
+		}
+		return strconv.Itoa(c.code)
+	case kind256:
+		if bg {
+			return "48;5;" + strconv.Itoa(c.code)
+		}
+		return "38;5;" + strconv.Itoa(c.code)
+	case kindRGB:
+		p := "38;2;"
+		if bg {
+			p = "48;2;"
+		}
+		return p + strconv.Itoa(int(c.r)) + ";" + strconv.Itoa(int(c.g)) + ";" + strconv.Itoa(int(c.b))
+	}
+	return ""
+}
+
+// build the escapes from fg, bg and attrs. The background escape paints fg as background
+func (cs *colorSet) build() {
+	params := make([]string, 0, len(cs.attrs)+2)
+	for _, a := range cs.attrs {
+		params = append(params, strconv.Itoa(a))
+	}
+	n := len(params)
+	if cs.fg.kind != kindNone {
+		params = append(params, cs.fg.sgr(false))
+	}
+	if cs.bg.kind != kindNone {
+		params = append(params, cs.bg.sgr(true))
+	}
+	cs.Str = sgr(params)
+	bgColor := cs.fg
+	if bgColor.kind == kindNone {
+		bgColor = cs.bg
+	}
+	if bgColor.kind != kindNone {
+		params = append(params[:n], bgColor.sgr(true))
+	} else {
+		params = params[:n]
+	}
+	cs.Bgstr = sgr(params)
+	cs.Bytes, cs.BgBytes = []byte(cs.Str), []byte(cs.Bgstr)
+	cs.Code, cs.Bgcode = 0, 0
+	if cs.fg.kind == kindBasic && cs.bg.kind == kindNone && len(cs.attrs) == 0 {
+		cs.Code, cs.Bgcode = cs.fg.code, cs.fg.code+10
+	}
+}
+
+func sgr(params []string) string {
+	if len(params) == 0 {
+		return ""
+	}
+	return EscapePrefix + strings.Join(params, ";") + "m"
+}
+
+// Color256 returns the color at index i of the 256 colors palette
+func Color256(i uint8) colorSet {
+	cs := colorSet{fg: color{kind: kind256, code: int(i)}}
+	cs.build()
+	return cs
+}
+
+// RGB returns a 24 bit color
+func RGB(r, g, b uint8) colorSet {
+	cs := colorSet{fg: color{kind: kindRGB, r: r, g: g, b: b}}
+	cs.build()
+	return cs
+}
+
+// Hex returns the 24 bit color of an html notation, "#ff8800" or "#f80"
+func Hex(s string) (colorSet, error) {
+	c, err := parseHex(s)
+	if err != nil {
+		return colorSet{}, err
+	}
+	cs := colorSet{fg: c}
+	cs.build()
+	return cs, nil
+}
+
+func parseHex(s string) (color, error) {
+	h := strings.TrimPrefix(s, "#")
+	if len(h) == 3 {
+		h = string([]byte{h[0], h[0], h[1], h[1], h[2], h[2]})
+	}
+	v, err := strconv.ParseUint(h, 16, 32)
+	if len(h) != 6 || err != nil {
+		return color{}, fmt.Errorf("invalid hex color %q", s)
+	}
+	return color{kind: kindRGB, r: uint8(v >> 16), g: uint8(v >> 8), b: uint8(v)}, nil
+}
+
+// attributes that can be combined with colors in ParseColor
+var attributes = map[string]int{
+	"bold":      1,
+	"dim":       2,
+	"italic":    3,
+	"underline": 4,
+	"blink":     5,
+	"reverse":   7,
+	"hide":      8,
+	"strike":    9,
+}
+
+// ParseColor parses a color or a style, parts joined by "+" like "bold+underline+Red":
+//   - names of Colors, in any case ("red", "BrightBlue")
+//   - indexes of the 256 colors palette ("208")
+//   - html notations of 24 bit colors ("#ff8800")
+//   - attributes: bold, dim, italic, underline, blink, reverse, hide, strike
+//   - any color prefixed with "bg" is a background ("bgBlue", "bg#003366")
+func ParseColor(spec string) (colorSet, error) {
+	var cs colorSet
+	for _, part := range strings.Split(spec, "+") {
+		part = strings.TrimSpace(part)
+		if a, ok := attributes[strings.ToLower(part)]; ok {
+			cs.attrs = append(cs.attrs, a)
+			continue
+		}
+		target := &cs.fg
+		if len(part) > 2 && strings.EqualFold(part[:2], "bg") {
+			if _, err := parseSingleColor(part); err != nil { // "bg..." is not a color name itself
+				target, part = &cs.bg, part[2:]
+			}
+		}
+		c, err := parseSingleColor(part)
+		if err != nil {
+			return colorSet{}, fmt.Errorf("invalid color %q: %s", spec, err)
+		}
+		if target.kind != kindNone {
+			return colorSet{}, fmt.Errorf("invalid color %q: more than one color for the same ground", spec)
+		}
+		*target = c
+	}
+	cs.build()
+	return cs, nil
+}
+
+func parseSingleColor(s string) (color, error) {
+	if strings.HasPrefix(s, "#") {
+		return parseHex(s)
+	}
+	if i, err := strconv.Atoi(s); err == nil {
+		if i < 0 || i > 255 {
+			return color{}, fmt.Errorf("palette index %d out of range", i)
+		}
+		return color{kind: kind256, code: i}, nil
+	}
+	for name, cs := range Colors {
+		if strings.EqualFold(name, s) {
+			return cs.fg, nil
+		}
+	}
+	return color{}, fmt.Errorf("unknown color %q", s)
+}
+
+// Profile is the color capability of a terminal
+type Profile int
+
+// Profiles, from the poorest
+const (
+	NoColor   Profile = iota // no escapes at all
+	ANSI                     // the 8 basic colors and their bright variants
+	ANSI256                  // the 256 colors palette
+	TrueColor                // 24 bit colors
+)
+
+// DetectProfile guesses the capability of the terminal from COLORTERM and TERM.
+// It never returns NoColor: whether to color at all is up to the caller (NO_COLOR...)
+func DetectProfile() Profile {
+	switch strings.ToLower(os.Getenv("COLORTERM")) {
+	case "truecolor", "24bit":
+		return TrueColor
+	}
+	term := strings.ToLower(os.Getenv("TERM"))
+	switch {
+	case strings.Contains(term, "truecolor"), strings.Contains(term, "24bit"), strings.Contains(term, "direct"):
+		return TrueColor
+	case strings.Contains(term, "256"):
+		return ANSI256
+	}
+	return ANSI
+}
+
+// Downgrade converts the colors to the closest ones available with profile p,
+// NoColor returns empty escapes
+func (cs colorSet) Downgrade(p Profile) colorSet {
+	if p == NoColor {
+		return colorSet{}
+	}
+	d := colorSet{fg: cs.fg.downgrade(p), bg: cs.bg.downgrade(p), attrs: cs.attrs}
+	d.build()
+	return d
+}
+
+func (c color) downgrade(p Profile) color {
+	switch {
+	case c.kind == kindRGB && p == ANSI256:
+		return color{kind: kind256, code: rgbTo256(c.r, c.g, c.b)}
+	case c.kind == kindRGB && p == ANSI:
+		return basicColor(nearest16(c.r, c.g, c.b))
+	case c.kind == kind256 && p == ANSI:
+		r, g, b := paletteRGB(c.code)
+		return basicColor(nearest16(r, g, b))
+	}
+	return c
+}
+
+// xterm defaults of the 16 basic colors
+var palette16 = [16][3]uint8{
+	{0, 0, 0}, {205, 0, 0}, {0, 205, 0}, {205, 205, 0}, {0, 0, 238}, {205, 0, 205}, {0, 205, 205}, {229, 229, 229},
+	{127, 127, 127}, {255, 0, 0}, {0, 255, 0}, {255, 255, 0}, {92, 92, 255}, {255, 0, 255}, {0, 255, 255}, {255, 255, 255},
+}
+
+var cubeLevels = [6]uint8{0, 95, 135, 175, 215, 255}
+
+// RGB value of an index of the 256 colors palette
+func paletteRGB(i int) (r, g, b uint8) {
+	switch {
+	case i < 16:
+		return palette16[i][0], palette16[i][1], palette16[i][2]
+	case i < 232:
+		i -= 16
+		return cubeLevels[i/36], cubeLevels[(i/6)%6], cubeLevels[i%6]
+	}
+	v := uint8(8 + (i-232)*10)
+	return v, v, v
+}
+
+func distance(r1, g1, b1, r2, g2, b2 uint8) int {
+	dr, dg, db := int(r1)-int(r2), int(g1)-int(g2), int(b1)-int(b2)
+	return dr*dr + dg*dg + db*db
+}
+
+// closest of the color cube and the grayscale ramp
+func rgbTo256(r, g, b uint8) int {
+	level := func(v uint8) int {
+		switch {
+		case v < 48:
+			return 0
+		case v < 115:
+			return 1
+		}
+		return (int(v) - 35) / 40
+	}
+	cube := 16 + 36*level(r) + 6*level(g) + level(b)
+	avg := (int(r) + int(g) + int(b)) / 3
+	gray := 255
+	if avg <= 238 {
+		gray = 232
+		if avg > 8 {
+			gray += (avg - 3) / 10
+		}
+	}
+	cr, cg, cb := paletteRGB(cube)
+	gr, gg, gb := paletteRGB(gray)
+	if distance(r, g, b, gr, gg, gb) < distance(r, g, b, cr, cg, cb) {
+		return gray
+	}
+	return cube
+}
+
+// SGR code of the closest basic or bright color
+func nearest16(r, g, b uint8) int {
+	best, min := 0, -1
+	for i, p := range palette16 {
+		if d := distance(r, g, b, p[0], p[1], p[2]); min == -1 || d < min {
+			best, min = i, d
+		}
+	}
+	if best < 8 {
+		return Black + best
+	}
+	return BrightBlack + best - 8
+}
@@ -0,0 +1,118 @@
+// COPYRIGHT (c) 2019-2021 SILVANO ZAMPARDI, ALL RIGHTS RESERVED.
+// The license for these sources can be found in the LICENSE file in the root directory of this source tree.
+
+package ansi
+
+import (
+	"io"
+	"strings"
+)
+
+// escState follows escape sequences one byte at a time, sequences are all ASCII
+// so multibyte UTF-8 characters never disturb it
+type escState uint8
+
+const (
+	stText    escState = iota
+	stEsc              // after ESC
+	stCSI              // ESC [ ... up to a final byte in 0x40-0x7e
+	stOSC              // ESC ] ... up to BEL or ST (ESC \)
+	stOSCEsc           // ESC inside an OSC
+	stCharset          // ESC ( and friends, one more byte
+)
+
+// visible advances the state with c and reports whether c is text
+func (s *escState) visible(c byte) bool {
+	switch *s {
+	case stText:
+		if c == 0x1b {
+			*s = stEsc
+			return false
+		}
+		return true
+	case stEsc:
+		switch c {
+		case '[':
+			*s = stCSI
+		case ']':
+			*s = stOSC
+		case '(', ')', '*', '+', '#', '%':
+			*s = stCharset
+		default:
+			*s = stText
+		}
+	case stCSI:
+		if c >= 0x40 && c <= 0x7e {
+			*s = stText
+		}
+	case stOSC:
+		switch c {
+		case 0x07:
+			*s = stText
+		case 0x1b:
+			*s = stOSCEsc
+		}
+	case stOSCEsc:
+		if c == '\\' {
+			*s = stText
+			return false
+		}
+		// not a string terminator, a new sequence interrupting the OSC
+		*s = stEsc
+		return s.visible(c)
+	case stCharset:
+		*s = stText
+	}
+	return false
+}
+
+// StripString removes CSI (colors, cursor movements...) and OSC (titles, hyperlinks...) sequences from s
+func StripString(s string) string {
+	if strings.IndexByte(s, 0x1b) == -1 {
+		return s
+	}
+	var b strings.Builder
+	b.Grow(len(s))
+	var state escState
+	for i := 0; i < len(s); i++ {
+		if state.visible(s[i]) {
+			b.WriteByte(s[i])
+		}
+	}
+	return b.String()
+}
+
+type stripWriter struct {
+	w     io.Writer
+	state escState
+}
+
+// NewStripWriter returns a Writer that removes escape sequences, like StripString,
+// before writing to w. Sequences split across writes are handled
+func NewStripWriter(w io.Writer) io.Writer {
+	return &stripWriter{w: w}
+}
+
+func (s *stripWriter) Write(p []byte) (int, error) {
+	start := -1
+	for i, c := range p {
+		if s.state.visible(c) {
+			if start == -1 {
+				start = i
+			}
+			continue
+		}
+		if start != -1 {
+			if _, err := s.w.Write(p[start:i]); err != nil {
+				return start, err
+			}
+			start = -1
+		}
+	}
+	if start != -1 {
+		if _, err := s.w.Write(p[start:]); err != nil {
+			return start, err
+		}
+	}
+	return len(p), nil
+}
@@ -0,0 +1,123 @@
+// COPYRIGHT (c) 2019-2021 SILVANO ZAMPARDI, ALL RIGHTS RESERVED.
+// The license for these sources can be found in the LICENSE file in the root directory of this source tree.
+
+package ansi
+
+import (
+	"fmt"
+	"io"
+	"strings"
+)
+
+// OSC 8 hyperlinks
+const (
+	linkPrefix = "\033]8;;"
+	linkSuffix = "\033\\"
+	linkClose  = linkPrefix + linkSuffix
+)
+
+// Style describes how to paint text. The zero Style paints nothing.
+// FG and BG are any Color (from Colors, ParseColor...), the foreground of BG is used as background.
+// Styled text can be nested: the inner resets restore the outer style
+type Style struct {
+	FG        Color
+	BG        Color
+	Bold      bool
+	Dim       bool
+	Italic    bool
+	Underline bool
+	Blink     bool
+	Reverse   bool
+	Strike    bool
+	Link      string // URL the text points to, for terminals supporting OSC 8 hyperlinks
+}
+
+// String returns the escape sequence starting the style
+func (st Style) String() string {
+	cs := colorSet{fg: st.FG.fg, bg: st.BG.fg, attrs: append([]int(nil), st.FG.attrs...)}
+	if cs.fg.kind == kindNone {
+		cs.fg = st.FG.bg
+	}
+	if cs.bg.kind == kindNone {
+		cs.bg = st.BG.bg
+	}
+	for _, a := range []struct {
+		on   bool
+		code int
+	}{
+		{st.Bold, 1}, {st.Dim, 2}, {st.Italic, 3}, {st.Underline, 4}, {st.Blink, 5}, {st.Reverse, 7}, {st.Strike, 9},
+	} {
+		if a.on {
+			cs.attrs = append(cs.attrs, a.code)
+		}
+	}
+	cs.build()
+	return cs.Str
+}
+
+// WriteTo writes the escape sequence starting the style (and the hyperlink) to w,
+// for streaming output terminated by Reset
+func (st Style) WriteTo(w io.Writer) (int64, error) {
+	start := st.String()
+	if st.Link != "" {
+		start = linkPrefix + st.Link + linkSuffix + start
+	}
+	n, err := io.WriteString(w, start)
+	return int64(n), err
+}
+
+// Wrap returns s painted with the style and followed by a reset, resets already in s
+// (of nested styled text) are followed by the style again so it applies to the whole s
+func (st Style) Wrap(s string) string {
+	start := st.String()
+	if start == "" && st.Link == "" {
+		return s
+	}
+	var b strings.Builder
+	if st.Link != "" {
+		b.WriteString(linkPrefix + st.Link + linkSuffix)
+	}
+	b.WriteString(start)
+	if start != "" {
+		s = restore(s, Controls["Reset"].Str, start)
+		s = restore(s, EscapePrefix+"m", start)
+	}
+	if st.Link != "" {
+		s = restore(s, linkClose, linkPrefix+st.Link+linkSuffix)
+	}
+	b.WriteString(s)
+	if start != "" {
+		b.WriteString(Controls["Reset"].Str)
+	}
+	if st.Link != "" {
+		b.WriteString(linkClose)
+	}
+	return b.String()
+}
+
+// follow every end in s, but a trailing one, with start
+func restore(s, end, start string) string {
+	if !strings.Contains(s, end) {
+		return s
+	}
+	s = strings.ReplaceAll(s, end, end+start)
+	if strings.HasSuffix(s, end+start) {
+		s = s[:len(s)-len(start)]
+	}
+	return s
+}
+
+// Sprint formats a like fmt.Sprint and wraps the result with the style
+func (st Style) Sprint(a ...interface{}) string {
+	return st.Wrap(fmt.Sprint(a...))
+}
+
+// Sprintf formats like fmt.Sprintf and wraps the result with the style
+func (st Style) Sprintf(format string, a ...interface{}) string {
+	return st.Wrap(fmt.Sprintf(format, a...))
+}
+
+// Link returns text pointing to url in terminals supporting OSC 8 hyperlinks
+func Link(url, text string) string {
+	return linkPrefix + url + linkSuffix + text + linkClose
+}
@@ -0,0 +1,121 @@
+// COPYRIGHT (c) 2019-2021 SILVANO ZAMPARDI, ALL RIGHTS RESERVED.
+// The license for these sources can be found in the LICENSE file in the root directory of this source tree.
+
+package ansi
+
+import (
+	"sort"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Width returns how many terminal columns s takes: escape sequences take none,
+// East Asian wide characters and emojis (including ZWJ sequences, skin tones
+// and flags) take two
+func Width(s string) int {
+	var state escState
+	var w widthCounter
+	for i := 0; i < len(s); {
+		if !state.visible(s[i]) {
+			i++
+			continue
+		}
+		r, size := utf8.DecodeRuneInString(s[i:])
+		w.add(r)
+		i += size
+	}
+	return w.n
+}
+
+// WidthBytes is Width for byte slices
+func WidthBytes(b []byte) int {
+	var state escState
+	var w widthCounter
+	for i := 0; i < len(b); {
+		if !state.visible(b[i]) {
+			i++
+			continue
+		}
+		r, size := utf8.DecodeRune(b[i:])
+		w.add(r)
+		i += size
+	}
+	return w.n
+}
+
+const (
+	zwj  = 0x200d
+	vs16 = 0xfe0f // emoji presentation selector
+)
+
+type widthCounter struct {
+	n         int
+	prev      rune
+	prevWidth int  // of the last character that was not a modifier
+	flag      bool // an odd regional indicator was seen, the next one completes the flag
+}
+
+func (w *widthCounter) add(r rune) {
+	regional := r >= 0x1f1e6 && r <= 0x1f1ff
+	rw := 0
+	switch {
+	case w.prev == zwj: // joined to the previous emoji
+	case r == vs16:
+		if w.prevWidth == 1 { // text characters like ⚠ become emojis
+			rw = 1
+		}
+	case regional && w.flag:
+	default:
+		rw = runeWidth(r)
+	}
+	w.flag = regional && !w.flag
+	w.n += rw
+	w.prev = r
+	switch {
+	case r == vs16:
+		w.prevWidth += rw
+	case rw > 0 || runeWidth(r) > 0:
+		w.prevWidth = rw
+	}
+}
+
+// width of a single character
+func runeWidth(r rune) int {
+	switch {
+	case r < 0x20, r >= 0x7f && r < 0xa0:
+		return 0
+	case r < 0x300: // fast path for latin
+		return 1
+	case r >= 0x1f3fb && r <= 0x1f3ff, // skin tones
+		r >= 0xfe00 && r <= 0xfe0f,   // variation selectors
+		r >= 0xe0000 && r <= 0xe0fff, // tags and supplementary variation selectors
+		unicode.In(r, unicode.Mn, unicode.Me, unicode.Cf):
+		return 0
+	case inTable(r, wide):
+		return 2
+	}
+	return 1
+}
+
+func inTable(r rune, table [][2]rune) bool {
+	i := sort.Search(len(table), func(i int) bool { return table[i][1] >= r })
+	return i < len(table) && table[i][0] <= r
+}
+
+// East Asian Wide and Fullwidth characters, and characters with emoji presentation
+var wide = [][2]rune{
+	{0x1100, 0x115f}, {0x231a, 0x231b}, {0x2329, 0x232a}, {0x23e9, 0x23ec}, {0x23f0, 0x23f0},
+	{0x23f3, 0x23f3}, {0x25fd, 0x25fe}, {0x2614, 0x2615}, {0x2648, 0x2653}, {0x267f, 0x267f},
+	{0x2693, 0x2693}, {0x26a1, 0x26a1}, {0x26aa, 0x26ab}, {0x26bd, 0x26be}, {0x26c4, 0x26c5},
+	{0x26ce, 0x26ce}, {0x26d4, 0x26d4}, {0x26ea, 0x26ea}, {0x26f2, 0x26f3}, {0x26f5, 0x26f5},
+	{0x26fa, 0x26fa}, {0x26fd, 0x26fd}, {0x2705, 0x2705}, {0x270a, 0x270b}, {0x2728, 0x2728},
+	{0x274c, 0x274c}, {0x274e, 0x274e}, {0x2753, 0x2755}, {0x2757, 0x2757}, {0x2795, 0x2797},
+	{0x27b0, 0x27b0}, {0x27bf, 0x27bf}, {0x2b1b, 0x2b1c}, {0x2b50, 0x2b50}, {0x2b55, 0x2b55},
+	{0x2e80, 0x303e}, {0x3041, 0x33ff}, {0x3400, 0x4dbf}, {0x4e00, 0x9fff}, {0xa000, 0xa4cf},
+	{0xa960, 0xa97f}, {0xac00, 0xd7a3}, {0xf900, 0xfaff}, {0xfe10, 0xfe19}, {0xfe30, 0xfe6f},
+	{0xff00, 0xff60}, {0xffe0, 0xffe6}, {0x16fe0, 0x16fe4}, {0x17000, 0x18aff}, {0x1b000, 0x1b16f},
+	{0x1f004, 0x1f004}, {0x1f0cf, 0x1f0cf}, {0x1f18e, 0x1f18e}, {0x1f191, 0x1f19a}, {0x1f1e6, 0x1f1ff},
+	{0x1f200, 0x1f202}, {0x1f210, 0x1f23b}, {0x1f240, 0x1f248}, {0x1f250, 0x1f251}, {0x1f260, 0x1f265},
+	{0x1f300, 0x1f64f}, {0x1f680, 0x1f6ff}, {0x1f7e0, 0x1f7eb}, {0x1f90c, 0x1f9ff}, {0x1fa70, 0x1faff},
+	{0x20000, 0x2fffd}, {0x30000, 0x3fffd},
+}
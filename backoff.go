@@ -0,0 +1,68 @@
+// COPYRIGHT (c) 2019-2021 SILVANO ZAMPARDI, ALL RIGHTS RESERVED.
+// The license for these sources can be found in the LICENSE file in the root directory of this source tree.
+
+package log
+
+import (
+	"math/rand"
+	"time"
+)
+
+// default delays between reconnections of network outputs
+const (
+	DefaultRetryMin = 100 * time.Millisecond
+	DefaultRetryMax = 30 * time.Second
+)
+
+// backoff spaces out reconnections: every failure doubles the delay before
+// the next attempt, up to max, minus a random jitter of up to a half so that
+// clients of a restarted server do not all come back at once. Callers check
+// ready rather than sleeping, so logging never blocks on a dead peer
+type backoff struct {
+	min, max time.Duration
+	failures uint
+	next     time.Time
+}
+
+func newBackoff(min, max time.Duration) backoff {
+	if min <= 0 {
+		min = DefaultRetryMin
+	}
+	if max < min {
+		max = DefaultRetryMax
+		if max < min {
+			max = min
+		}
+	}
+	return backoff{min: min, max: max}
+}
+
+func (b *backoff) ready(now time.Time) bool {
+	return !now.Before(b.next)
+}
+
+// fail schedules the next attempt
+func (b *backoff) fail(now time.Time) {
+	delay := b.max
+	if b.failures < 32 {
+		if d := b.min << b.failures; d > 0 && d < b.max {
+			delay = d
+		}
+	}
+	delay -= time.Duration(rand.Int63n(int64(delay)/2 + 1))
+	b.failures++
+	b.next = now.Add(delay)
+}
+
+func (b *backoff) reset() {
+	b.failures = 0
+	b.next = time.Time{}
+}
+
+// wait is how long until the next attempt
+func (b *backoff) wait(now time.Time) time.Duration {
+	if d := b.next.Sub(now); d > 0 {
+		return d
+	}
+	return 0
+}
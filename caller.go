@@ -0,0 +1,124 @@
+// COPYRIGHT (c) 2019-2021 SILVANO ZAMPARDI, ALL RIGHTS RESERVED.
+// The license for these sources can be found in the LICENSE file in the root directory of this source tree.
+
+package log
+
+import (
+	"path"
+	"runtime"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+var (
+	helpers    sync.Map // function names marked with Helper
+	hasHelpers uint32   // set once anything was marked, saves the lookups otherwise
+)
+
+// Helper marks the calling function as a logging helper, just like testing.T.Helper.
+// When resolving the caller of an entry, helper functions are skipped so the
+// reported file, line and function are the ones of the code calling the helper.
+func Helper() {
+	markHelper(3)
+}
+
+// Helper marks the calling function as a logging helper, see Helper
+func (l *Logger) Helper() {
+	markHelper(3)
+}
+
+func markHelper(skip int) {
+	var pc [1]uintptr
+	if runtime.Callers(skip, pc[:]) == 0 {
+		return
+	}
+	frame, _ := runtime.CallersFrames(pc[:]).Next()
+	if _, loaded := helpers.LoadOrStore(frame.Function, struct{}{}); !loaded {
+		atomic.StoreUint32(&hasHelpers, 1)
+	}
+}
+
+func isHelper(function string) bool {
+	if atomic.LoadUint32(&hasHelpers) == 0 {
+		return false
+	}
+	_, ok := helpers.Load(function)
+	return ok
+}
+
+// WithCallerSkip returns a copy of the Logger that skips n additional stack frames
+// when resolving the caller, for functions wrapping a Logger.
+// Skips are cumulative and the copy shares output, format and level with l
+func (l *Logger) WithCallerSkip(n int) *Logger {
+	c := *l
+	c.callerSkip += n
+	if c.callerSkip < 0 {
+		c.callerSkip = 0
+	}
+	return &c
+}
+
+// SetCallerLookup enables or disables resolving file, line and function of every entry.
+// Disabling it makes logging cheaper, caller placeholders are then rendered empty
+func (l *Logger) SetCallerLookup(enabled bool) {
+	var off uint32
+	if !enabled {
+		off = 1
+	}
+	atomic.StoreUint32(&l.worker.noCaller, off)
+}
+
+// fill the caller fields of r with the first frame past skip that is not a helper.
+// skip counts like runtime.Caller: 0 is the function calling resolveCaller
+func (r *info) resolveCaller(skip int) {
+	var pcs [16]uintptr
+	for {
+		n := runtime.Callers(skip+2, pcs[:])
+		if n == 0 {
+			return
+		}
+		frames := runtime.CallersFrames(pcs[:n])
+		for {
+			frame, more := frames.Next()
+			if !isHelper(frame.Function) {
+				r.Path = frame.File
+				r.Filename = path.Base(frame.File)
+				r.Line = frame.Line
+				r.Package, r.Func = splitFuncName(frame.Function)
+				return
+			}
+			if !more {
+				break
+			}
+		}
+		if n < len(pcs) {
+			return
+		}
+		// a deep chain of helpers, keep walking past the PCs read, a PC can be
+		// several frames once inlined calls are expanded
+		skip += n
+	}
+}
+
+// split a fully qualified function name ("github.com/a/b.(*T).M") into its
+// package import path ("github.com/a/b") and function name ("(*T).M")
+func splitFuncName(name string) (pkg, fn string) {
+	slash := strings.LastIndexByte(name, '/')
+	if dot := strings.IndexByte(name[slash+1:], '.'); dot != -1 {
+		return name[:slash+1+dot], name[slash+2+dot:]
+	}
+	return "", name
+}
+
+// keep the file name and the last depth directories of a path
+func shortPath(p string, depth int) string {
+	i := len(p)
+	for n := 0; n <= depth; n++ {
+		i = strings.LastIndexByte(p[:i], '/')
+		if i == -1 {
+			return p
+		}
+	}
+	return p[i+1:]
+}
@@ -0,0 +1,132 @@
+// COPYRIGHT (c) 2019-2021 SILVANO ZAMPARDI, ALL RIGHTS RESERVED.
+// The license for these sources can be found in the LICENSE file in the root directory of this source tree.
+
+package log
+
+import (
+	"strconv"
+	"time"
+)
+
+// Clock gives the time of entries, see SetClock
+type Clock interface {
+	Now() time.Time
+}
+
+// ClockFunc is a function used as a Clock, like a fixed time in tests:
+//
+//	l.SetClock(msg.ClockFunc(func() time.Time { return time.Unix(0, 0) }))
+type ClockFunc func() time.Time
+
+// Now calls f
+func (f ClockFunc) Now() time.Time {
+	return f()
+}
+
+// where the time of entries comes from, replaced as a whole
+type timeSource struct {
+	clock Clock          // time.Now when nil
+	loc   *time.Location // the one of clock when nil
+}
+
+func (w *worker) now() time.Time {
+	ts, _ := w.timeSource.Load().(*timeSource)
+	if ts == nil {
+		return time.Now()
+	}
+	var t time.Time
+	if ts.clock != nil {
+		t = ts.clock.Now()
+	} else {
+		t = time.Now()
+	}
+	if ts.loc != nil {
+		t = t.In(ts.loc)
+	}
+	return t
+}
+
+func (w *worker) getTimeSource() timeSource {
+	if ts, ok := w.timeSource.Load().(*timeSource); ok {
+		return *ts
+	}
+	return timeSource{}
+}
+
+func (w *worker) setClock(c Clock) {
+	w.mu.Lock()
+	ts := w.getTimeSource()
+	ts.clock = c
+	w.timeSource.Store(&ts)
+	w.mu.Unlock()
+}
+
+func (w *worker) setLocation(loc *time.Location) {
+	w.mu.Lock()
+	w.storeLocation(loc)
+	w.mu.Unlock()
+}
+
+// the caller holds mu
+func (w *worker) storeLocation(loc *time.Location) {
+	ts := w.getTimeSource()
+	ts.loc = loc
+	w.timeSource.Store(&ts)
+}
+
+// t in the current location of w, the local one without one: t may be in the one
+// replaced since it was taken
+func (w *worker) inLocation(t time.Time) time.Time {
+	if loc := w.getTimeSource().loc; loc != nil {
+		return t.In(loc)
+	}
+	return t.In(time.Local)
+}
+
+// SetClock makes the Logger take the time of its entries from c, time.Now when nil
+func (l *Logger) SetClock(c Clock) {
+	l.worker.setClock(c)
+}
+
+// SetLocation makes the Logger write times in loc (time.UTC, or one given by time.LoadLocation),
+// the local time zone when nil. Entries given to an EntryWriter have their Time in loc too
+func (l *Logger) SetLocation(loc *time.Location) {
+	l.worker.setLocation(loc)
+}
+
+// Location returns the time zone of the Logger, nil when it is the one of its Clock
+func (l *Logger) Location() *time.Location {
+	return l.worker.getTimeSource().loc
+}
+
+// SetClock changes the Clock of the default Logger
+func SetClock(c Clock) {
+	Default().SetClock(c)
+}
+
+// SetLocation changes the time zone of the default Logger, see SetDefaultLocation for the
+// Loggers created afterwards
+func SetLocation(loc *time.Location) {
+	Default().SetLocation(loc)
+}
+
+// the time as a number for the Unix time formats, layout is not one when false
+func unixTime(t time.Time, layout string) (int64, bool) {
+	switch layout {
+	case UnixTimeFmt:
+		return t.Unix(), true
+	case UnixMilliTimeFmt:
+		return t.UnixNano() / int64(time.Millisecond), true
+	case UnixNanoTimeFmt:
+		return t.UnixNano(), true
+	}
+	return 0, false
+}
+
+// append t formatted with layout, or as a number for the Unix time formats
+func appendTime(dst []byte, t time.Time, layout string) []byte {
+	if n, ok := unixTime(t, layout); ok {
+		return strconv.AppendInt(dst, n, 10)
+	}
+	return t.AppendFormat(dst, layout)
+}
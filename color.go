@@ -0,0 +1,82 @@
+// COPYRIGHT (c) 2019-2021 SILVANO ZAMPARDI, ALL RIGHTS RESERVED.
+// The license for these sources can be found in the LICENSE file in the root directory of this source tree.
+
+package log
+
+import (
+	"io"
+	"os"
+	"strings"
+	"sync/atomic"
+
+	"github.com/szampardi/msg/ansi"
+)
+
+// ColorMode decides whether a Logger produces colored output
+type ColorMode int
+
+// Color modes, pass one to New (a bool is still accepted: true is ColorAlways, false ColorNever)
+const (
+	ColorAuto   ColorMode = iota // color only terminals, following NO_COLOR, FORCE_COLOR, CLICOLOR and TERM
+	ColorAlways                  // always color
+	ColorNever                   // never color
+)
+
+// SetColor changes the color mode of the Logger, ColorAuto is evaluated
+// against the current output and again whenever SetOutput changes it
+func (l *Logger) SetColor(mode ColorMode) {
+	l.worker.setColor(mode, l.worker.Minion.Writer())
+}
+
+// Color returns the color mode of the Logger
+func (l *Logger) Color() ColorMode {
+	return ColorMode(atomic.LoadInt32(&l.worker.colorMode))
+}
+
+// resolve mode for out, with the environment of now: colors of formats are
+// downgraded to the profile of the output when writing
+func (w *worker) setColor(mode ColorMode, out io.Writer) {
+	atomic.StoreInt32(&w.colorMode, int32(mode))
+	profile := ansi.NoColor
+	if mode == ColorAlways || mode == ColorAuto && ColorSupported(out) {
+		profile = ansi.DetectProfile()
+	}
+	atomic.StoreUint32(&w.color, uint32(profile))
+}
+
+func (w *worker) profile() ansi.Profile {
+	return ansi.Profile(atomic.LoadUint32(&w.color))
+}
+
+// ColorSupported reports whether colors should be written to out: environment variables
+// come first (NO_COLOR disables colors, FORCE_COLOR or CLICOLOR_FORCE enable them,
+// CLICOLOR=0 and TERM=dumb disable them), then out must be a terminal
+func ColorSupported(out io.Writer) bool {
+	if _, ok := os.LookupEnv("NO_COLOR"); ok {
+		return false
+	}
+	if envTrue("FORCE_COLOR") || envTrue("CLICOLOR_FORCE") {
+		return true
+	}
+	if v, ok := os.LookupEnv("CLICOLOR"); ok && v == "0" {
+		return false
+	}
+	if os.Getenv("TERM") == "dumb" {
+		return false
+	}
+	f, ok := out.(*os.File)
+	return ok && isTerminal(f)
+}
+
+// a variable is true when set to anything but empty, 0 or false
+func envTrue(key string) bool {
+	v, ok := os.LookupEnv(key)
+	if !ok {
+		return false
+	}
+	switch strings.ToLower(v) {
+	case "", "0", "false", "no":
+		return false
+	}
+	return true
+}
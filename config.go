@@ -0,0 +1,407 @@
+// COPYRIGHT (c) 2019-2021 SILVANO ZAMPARDI, ALL RIGHTS RESERVED.
+// The license for these sources can be found in the LICENSE file in the root directory of this source tree.
+
+package log
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Config describes Loggers, to be loaded from a JSON file with LoadConfig and built
+// with FromConfig:
+//
+//	{
+//	  "loggers": {
+//	    "api": {"format": "std", "level": "info", "outputs": [{"type": "stderr"}]},
+//	    "db": {"format": "json", "level": "debug", "hooks": ["alerts"],
+//	      "outputs": [{"type": "rotating", "path": "/var/log/db.log", "max_size": 10485760, "max_backups": 5}]}
+//	  }
+//	}
+type Config struct {
+	Loggers map[string]LoggerConfig `json:"loggers"`
+}
+
+// LoggerConfig describes a Logger
+type LoggerConfig struct {
+	Module     string         `json:"module,omitempty"`      // the name of the Logger by default
+	Format     string         `json:"format,omitempty"`      // a name of Formats or a format, see SetDefaultFormat
+	TimeFormat string         `json:"time_format,omitempty"` // a name of Formats or a time layout, see SetDefaultTimeFormat
+	Location   string         `json:"location,omitempty"`    // UTC, Local or a time zone like Europe/Rome, see SetDefaultLocation
+	Level      string         `json:"level,omitempty"`       // see ParseLevel, notice by default
+	Color      string         `json:"color,omitempty"`       // auto, always or never, auto by default
+	Outputs    []OutputConfig `json:"outputs,omitempty"`     // stderr by default
+	Hooks      []string       `json:"hooks,omitempty"`       // names given to RegisterHook
+}
+
+// OutputConfig describes an output, the fields used depend on its type:
+//   - stdout, stderr
+//   - file: path
+//   - rotating: path, max_size, max_backups
+//   - syslog: network, address, syslog_format (rfc5424, rfc3164), facility (user, local0...), app_name
+//   - network: network (tcp, udp, tls, unix...), address, framing (newline, length), buffer_size, spool, spool_max
+//   - http: url, headers, gzip, encoding (ndjson, array)
+type OutputConfig struct {
+	Type         string            `json:"type"`
+	Path         string            `json:"path,omitempty"`
+	MaxSize      int64             `json:"max_size,omitempty"`
+	MaxBackups   int               `json:"max_backups,omitempty"`
+	Network      string            `json:"network,omitempty"`
+	Address      string            `json:"address,omitempty"`
+	SyslogFormat string            `json:"syslog_format,omitempty"`
+	Facility     string            `json:"facility,omitempty"`
+	AppName      string            `json:"app_name,omitempty"`
+	Framing      string            `json:"framing,omitempty"`
+	BufferSize   int               `json:"buffer_size,omitempty"`
+	Spool        string            `json:"spool,omitempty"`
+	SpoolMax     int64             `json:"spool_max,omitempty"`
+	URL          string            `json:"url,omitempty"`
+	Headers      map[string]string `json:"headers,omitempty"`
+	Gzip         bool              `json:"gzip,omitempty"`
+	Encoding     string            `json:"encoding,omitempty"`
+}
+
+// LoadConfig reads a JSON Config, unknown keys are errors
+func LoadConfig(path string) (*Config, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return ParseConfig(b)
+}
+
+// ParseConfig parses a JSON Config, unknown keys are errors
+func ParseConfig(b []byte) (*Config, error) {
+	d := json.NewDecoder(bytes.NewReader(b))
+	d.DisallowUnknownFields()
+	cfg := new(Config)
+	if err := d.Decode(cfg); err != nil {
+		return nil, fmt.Errorf("invalid config: %s", err)
+	}
+	return cfg, nil
+}
+
+// Hook is called with the entries of the Loggers it is configured for, after they
+// are written and without holding any lock: it may log, even to the same Logger,
+// as long as it does not do so for every entry it gets. It must not modify the entry
+type Hook func(e *Entry)
+
+var (
+	hooksMu sync.RWMutex
+	hooks   = map[string]Hook{}
+)
+
+// RegisterHook names a Hook for the "hooks" of LoggerConfig
+func RegisterHook(name string, h Hook) {
+	hooksMu.Lock()
+	hooks[name] = h
+	hooksMu.Unlock()
+}
+
+// FromConfig builds the Loggers of cfg by name. Errors name the key at fault,
+// like "loggers.api.outputs[1].address"
+func FromConfig(cfg *Config) (map[string]*Logger, error) {
+	loggers := make(map[string]*Logger, len(cfg.Loggers))
+	names := make([]string, 0, len(cfg.Loggers))
+	for name := range cfg.Loggers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		l, err := cfg.Loggers[name].build("loggers." + name)
+		if err != nil {
+			for _, l := range loggers {
+				closeOutput(l.worker.Minion.Writer())
+			}
+			return nil, err
+		}
+		if l.Module == "" {
+			l.Module = name
+		}
+		loggers[name] = l
+	}
+	return loggers, nil
+}
+
+func (c LoggerConfig) build(key string) (*Logger, error) {
+	s, err := c.settings(key, true)
+	if err != nil {
+		return nil, err
+	}
+	return &Logger{Module: c.Module, worker: s.newWorker()}, nil
+}
+
+// what a LoggerConfig makes of a Logger, the output is only opened if asked
+type loggerSettings struct {
+	level     Lvl
+	color     ColorMode
+	formatter *formatter
+	loc       *time.Location
+	out       io.Writer
+}
+
+func (s *loggerSettings) newWorker() *worker {
+	w := newFormattedWorker("", s.formatter, 0, s.color, s.out, s.level)
+	if s.loc != nil {
+		w.setLocation(s.loc)
+	}
+	return w
+}
+
+func (c LoggerConfig) settings(key string, withOutput bool) (*loggerSettings, error) {
+	s := &loggerSettings{level: LDefault, color: ColorAuto, loc: getDefaultFormats().loc}
+	var err error
+	if c.Level != "" {
+		if s.level, err = ParseLevel(c.Level); err != nil {
+			return nil, fmt.Errorf("%s.level: %s", key, err)
+		}
+	}
+	if c.Color != "" {
+		if s.color, err = ParseColorMode(c.Color); err != nil {
+			return nil, fmt.Errorf("%s.color: %s", key, err)
+		}
+	}
+	if s.formatter, err = newFormatter(c.Format, c.TimeFormat); err != nil {
+		return nil, fmt.Errorf("%s.format: %s", key, err)
+	}
+	if c.Location != "" {
+		if s.loc, err = time.LoadLocation(c.Location); err != nil {
+			return nil, fmt.Errorf("%s.location: %s", key, err)
+		}
+	}
+	var hs []Hook
+	for i, name := range c.Hooks {
+		hooksMu.RLock()
+		h, ok := hooks[name]
+		hooksMu.RUnlock()
+		if !ok {
+			return nil, fmt.Errorf("%s.hooks[%d]: unknown hook %q", key, i, name)
+		}
+		hs = append(hs, h)
+	}
+	if !withOutput {
+		return s, nil
+	}
+	var outs []io.Writer
+	for i, o := range c.Outputs {
+		w, err := o.open()
+		if err != nil {
+			for _, w := range outs {
+				closeOutput(w)
+			}
+			return nil, fmt.Errorf("%s.outputs[%d].%s", key, i, err)
+		}
+		outs = append(outs, w)
+	}
+	s.out = os.Stderr
+	switch {
+	case len(outs) == 1 && len(hs) == 0:
+		s.out = outs[0]
+	case len(outs) > 0 || len(hs) > 0:
+		if len(outs) == 0 {
+			outs = []io.Writer{os.Stderr}
+		}
+		s.out = &multiOutput{outs: outs, hooks: hs}
+	}
+	return s, nil
+}
+
+// open the output, errors start with the key at fault
+func (o OutputConfig) open() (io.Writer, error) {
+	required := func(key, value string) error {
+		if value == "" {
+			return fmt.Errorf("%s: required for %s outputs", key, o.Type)
+		}
+		return nil
+	}
+	switch o.Type {
+	case "stdout":
+		return os.Stdout, nil
+	case "stderr":
+		return os.Stderr, nil
+	case "file":
+		if err := required("path", o.Path); err != nil {
+			return nil, err
+		}
+		f, err := os.OpenFile(o.Path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+		if err != nil {
+			return nil, fmt.Errorf("path: %s", err)
+		}
+		return f, nil
+	case "rotating":
+		if err := required("path", o.Path); err != nil {
+			return nil, err
+		}
+		if o.MaxSize <= 0 {
+			return nil, fmt.Errorf("max_size: must be positive")
+		}
+		f, err := NewRotatingFile(o.Path, o.MaxSize, o.MaxBackups)
+		if err != nil {
+			return nil, fmt.Errorf("path: %s", err)
+		}
+		return f, nil
+	case "syslog":
+		sc := SyslogConfig{Network: o.Network, Address: o.Address, AppName: o.AppName, Facility: FacilityUser}
+		switch strings.ToLower(o.SyslogFormat) {
+		case "", "rfc5424":
+		case "rfc3164":
+			sc.Format = RFC3164
+		default:
+			return nil, fmt.Errorf("syslog_format: expected rfc5424 or rfc3164")
+		}
+		if o.Facility != "" {
+			f, ok := facilities[strings.ToLower(o.Facility)]
+			if !ok {
+				return nil, fmt.Errorf("facility: unknown facility %q", o.Facility)
+			}
+			sc.Facility = f
+		}
+		if o.Framing == "newline" {
+			sc.Framing = NonTransparent
+		}
+		w, err := NewSyslogWriter(sc)
+		if err != nil {
+			key := "address"
+			var unknown net.UnknownNetworkError
+			if o.Network == "" || errors.As(err, &unknown) {
+				key = "network" // no local daemon, or not a network
+			}
+			return nil, fmt.Errorf("%s: %s", key, err)
+		}
+		return w, nil
+	case "network":
+		if err := required("address", o.Address); err != nil {
+			return nil, err
+		}
+		if _, ok := netStream(o.Network); !ok {
+			return nil, fmt.Errorf("network: unsupported network %q", o.Network)
+		}
+		nc := NetConfig{Network: o.Network, Address: o.Address, BufferSize: o.BufferSize, SpoolFile: o.Spool, SpoolMax: o.SpoolMax}
+		switch o.Framing {
+		case "", "newline":
+		case "length":
+			nc.Framing = LengthPrefixed
+		default:
+			return nil, fmt.Errorf("framing: expected newline or length")
+		}
+		w, err := NewNetWriter(nc)
+		if err != nil {
+			return nil, fmt.Errorf("spool: %s", err) // the only one left to fail
+		}
+		return w, nil
+	case "http":
+		hc := HTTPConfig{URL: o.URL, Headers: o.Headers, Gzip: o.Gzip}
+		switch o.Encoding {
+		case "", "ndjson":
+		case "array":
+			hc.Encoding = JSONArray
+		default:
+			return nil, fmt.Errorf("encoding: expected ndjson or array")
+		}
+		w, err := NewHTTPWriter(hc)
+		if err != nil {
+			return nil, fmt.Errorf("url: %s", err)
+		}
+		return w, nil
+	case "":
+		return nil, fmt.Errorf("type: required")
+	}
+	return nil, fmt.Errorf("type: unknown output %q", o.Type)
+}
+
+// facility names, as in syslog.conf
+var facilities = map[string]Facility{
+	"kern":     FacilityKern,
+	"user":     FacilityUser,
+	"mail":     FacilityMail,
+	"daemon":   FacilityDaemon,
+	"auth":     FacilityAuth,
+	"syslog":   FacilitySyslog,
+	"lpr":      FacilityLPR,
+	"news":     FacilityNews,
+	"uucp":     FacilityUUCP,
+	"cron":     FacilityCron,
+	"authpriv": FacilityAuthPriv,
+	"ftp":      FacilityFTP,
+	"local0":   FacilityLocal0,
+	"local1":   FacilityLocal1,
+	"local2":   FacilityLocal2,
+	"local3":   FacilityLocal3,
+	"local4":   FacilityLocal4,
+	"local5":   FacilityLocal5,
+	"local6":   FacilityLocal6,
+	"local7":   FacilityLocal7,
+}
+
+// close outputs opened from a config, never the standard ones
+func closeOutput(w io.Writer) error {
+	if w == os.Stdout || w == os.Stderr {
+		return nil
+	}
+	if c, ok := w.(io.Closer); ok {
+		return c.Close()
+	}
+	return nil
+}
+
+// multiOutput writes to several outputs, its hooks are run by the worker once written
+type multiOutput struct {
+	outs  []io.Writer
+	hooks []Hook
+}
+
+func (m *multiOutput) Write(p []byte) (int, error) {
+	var first error
+	for _, w := range m.outs {
+		if _, err := w.Write(p); err != nil && first == nil {
+			first = err
+		}
+	}
+	return len(p), first
+}
+
+func (m *multiOutput) WriteEntry(e *Entry, p []byte) (int, error) {
+	var first error
+	for _, w := range m.outs {
+		var err error
+		if ew, ok := w.(EntryWriter); ok {
+			_, err = ew.WriteEntry(e, p)
+		} else {
+			_, err = w.Write(p)
+		}
+		if err != nil && first == nil {
+			first = err
+		}
+	}
+	return len(p), first
+}
+
+// hookRunner is an output with hooks to call after writing an entry
+type hookRunner interface {
+	runHooks(e *Entry)
+}
+
+func (m *multiOutput) runHooks(e *Entry) {
+	for _, h := range m.hooks {
+		h(e)
+	}
+}
+
+func (m *multiOutput) Close() error {
+	var first error
+	for _, w := range m.outs {
+		if err := closeOutput(w); err != nil && first == nil {
+			first = err
+		}
+	}
+	return first
+}
@@ -0,0 +1,345 @@
+// COPYRIGHT (c) 2019-2021 SILVANO ZAMPARDI, ALL RIGHTS RESERVED.
+// The license for these sources can be found in the LICENSE file in the root directory of this source tree.
+
+package log
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestFromConfig(t *testing.T) {
+	dir := t.TempDir()
+	var hooked []string
+	RegisterHook("test", func(e *Entry) { hooked = append(hooked, e.Module+" "+e.Message) })
+	cfg, err := ParseConfig([]byte(`{
+		"loggers": {
+			"api": {"format": "%{module} %{lvl} %{message}", "level": "info", "color": "never",
+				"outputs": [{"type": "file", "path": "` + filepath.Join(dir, "api.log") + `"}]},
+			"db": {"module": "database", "format": "plain", "level": "warn", "hooks": ["test"],
+				"outputs": [{"type": "rotating", "path": "` + filepath.Join(dir, "db.log") + `", "max_size": 12, "max_backups": 1}]}
+		}
+	}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	loggers, err := FromConfig(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	loggers["api"].Debug("hidden")
+	loggers["api"].Info("shown")
+	loggers["db"].Warning("first")
+	loggers["db"].Error("second")
+	for _, l := range loggers {
+		closeOutput(l.worker.Minion.Writer())
+	}
+	for file, want := range map[string]string{"api.log": "api INF shown\n", "db.log.1": "first\n", "db.log": "second\n"} {
+		b, err := os.ReadFile(filepath.Join(dir, file))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if have := string(b); want != have {
+			t.Errorf("%s\nWant: %sHave: %s", file, want, have)
+		}
+	}
+	if have := strings.Join(hooked, ","); have != "database first,database second" {
+		t.Errorf("Unexpected hook calls %q", have)
+	}
+}
+
+func TestHookLogging(t *testing.T) {
+	var l *Logger
+	RegisterHook("alert", func(e *Entry) {
+		if e.Level == LErr {
+			l.Noticef("alerted about %q", e.Message)
+		}
+	})
+	path := filepath.Join(t.TempDir(), "out.log")
+	cfg, err := ParseConfig([]byte(`{"loggers": {"app": {"format": "%{lvl} %{message}", "hooks": ["alert"],
+		"outputs": [{"type": "file", "path": "` + path + `"}]}}}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	loggers, err := FromConfig(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	l = loggers["app"]
+	defer closeOutput(l.worker.Minion.Writer())
+	done := make(chan struct{})
+	go func() {
+		l.Error("disk full")
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("A hook logging to its Logger deadlocked")
+	}
+	b, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want, have := "ERR disk full\nNOT alerted about \"disk full\"\n", string(b); want != have {
+		t.Errorf("\nWant: %sHave: %s", want, have)
+	}
+}
+
+func TestConfigErrors(t *testing.T) {
+	for config, want := range map[string]string{
+		`{"loggers": {"a": {"levle": "info"}}}`:                                                                                 `unknown field "levle"`,
+		`{"loggers": {"a": {"level": "loud"}}}`:                                                                                 "loggers.a.level: ",
+		`{"loggers": {"a": {"format": "%{nope}"}}}`:                                                                             "loggers.a.format: ",
+		`{"loggers": {"a": {"location": "Nowhere/Nope"}}}`:                                                                      "loggers.a.location: ",
+		`{"loggers": {"a": {"hooks": ["nope"]}}}`:                                                                               `loggers.a.hooks[0]: unknown hook "nope"`,
+		`{"loggers": {"a": {"outputs": [{"type": "stdout"}, {"type": "file"}]}}}`:                                               "loggers.a.outputs[1].path: required for file outputs",
+		`{"loggers": {"a": {"outputs": [{"type": "network", "address": "x:1"}]}}}`:                                              `loggers.a.outputs[0].network: unsupported network ""`,
+		`{"loggers": {"a": {"outputs": [{"type": "syslog", "facility": "nope"}]}}}`:                                             `loggers.a.outputs[0].facility: unknown facility "nope"`,
+		`{"loggers": {"a": {"outputs": [{"type": "syslog", "network": "pigeon", "address": "x:1"}]}}}`:                          "loggers.a.outputs[0].network: ",
+		`{"loggers": {"a": {"outputs": [{"type": "syslog", "network": "unix", "address": "/nonexistent/log"}]}}}`:               "loggers.a.outputs[0].address: ",
+		`{"loggers": {"a": {"outputs": [{"type": "network", "network": "tcp", "address": "x:1", "spool": "/nonexistent/s"}]}}}`: "loggers.a.outputs[0].spool: ",
+		`{"loggers": {"a": {"outputs": [{"type": "carrier pigeon"}]}}}`:                                                         `loggers.a.outputs[0].type: unknown output "carrier pigeon"`,
+	} {
+		cfg, err := ParseConfig([]byte(config))
+		if err == nil {
+			_, err = FromConfig(cfg)
+		}
+		if err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("%s\nWant an error with: %s\nHave: %v", config, want, err)
+		}
+	}
+}
+
+func TestWatchConfig(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "config.json")
+	write := func(level, file string) {
+		config := `{"loggers": {"api": {"format": "%{lvl} %{message}", "level": "` + level + `",
+			"outputs": [{"type": "file", "path": "` + filepath.Join(dir, file) + `"}]}}}`
+		if err := os.WriteFile(path, []byte(config), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	read := func(file string) string {
+		b, err := os.ReadFile(filepath.Join(dir, file))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return string(b)
+	}
+	notices := new(bytes.Buffer)
+	defer defaultLogger.SetOutput(defaultLogger.worker.setOutput(notices))
+
+	write("info", "a.log")
+	w, err := WatchConfig(path, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Close()
+	l := w.Logger("api")
+	l.Debug("hidden")
+	l.Info("one")
+	first := l.worker.Minion.Writer().(*os.File)
+
+	write("debug", "b.log")
+	if err := w.Reload(); err != nil {
+		t.Fatal(err)
+	}
+	l.Debug("two")
+	if _, err := first.Write([]byte("x")); !errors.Is(err, os.ErrClosed) {
+		t.Errorf("Retired output not closed: %v", err)
+	}
+	if have := notices.String(); !strings.Contains(have, `api level "info" -> "debug", api outputs`) {
+		t.Errorf("Unexpected reload notice %q", have)
+	}
+
+	write("loud", "c.log")
+	if err := w.Reload(); err == nil || !strings.Contains(err.Error(), "loggers.api.level") {
+		t.Errorf("Unexpected error %v", err)
+	}
+	l.Debug("three")
+	if _, err := os.Stat(filepath.Join(dir, "c.log")); !os.IsNotExist(err) {
+		t.Errorf("Invalid config applied")
+	}
+	if have := read("a.log"); have != "INF one\n" {
+		t.Errorf("a.log: %q", have)
+	}
+	if have := read("b.log"); have != "DEB two\nDEB three\n" {
+		t.Errorf("b.log: %q", have)
+	}
+	closeOutput(l.worker.Minion.Writer())
+}
+
+func TestWatchConfigPolling(t *testing.T) {
+	dir := t.TempDir()
+	path, out := filepath.Join(dir, "config.json"), filepath.Join(dir, "default.log")
+	write := func(level string, mtime time.Time) {
+		config := `{"loggers": {"default": {"format": "%{lvl} %{message}", "level": "` + level + `",
+			"outputs": [{"type": "file", "path": "` + out + `"}]}}}`
+		if err := os.WriteFile(path, []byte(config), 0644); err != nil {
+			t.Fatal(err)
+		}
+		os.Chtimes(path, mtime, mtime)
+	}
+	l, err := New(PlainFormat, DefTimeFmt, &bytes.Buffer{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	SetDefault(&l)
+	defer SetDefault(nil)
+
+	write("info", time.Now().Add(-time.Minute))
+	w, err := WatchConfig(path, 5*time.Millisecond)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if w.Logger("default") != &l {
+		t.Fatal(`"default" does not configure the default Logger`)
+	}
+	Debug("hidden")
+	Info("one")
+	write("debug", time.Now())
+	deadline := time.Now().Add(5 * time.Second)
+	for l.LogLevel() != LDebug && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	w.Close()
+	Debug("two")
+	closeOutput(l.OutputWriter())
+	b, err := os.ReadFile(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "INF one\nNOT reloaded logging config " + path + `: default level "info" -> "debug"` + "\nDEB two\n"
+	if have := string(b); want != have {
+		t.Errorf("\nWant: %sHave: %s", want, have)
+	}
+}
+
+// an output of the program, that the Watcher must not close
+type programOutput struct {
+	bytes.Buffer
+	closed bool
+}
+
+func (o *programOutput) Close() error {
+	o.closed = true
+	return nil
+}
+
+func TestWatchConfigDefaultRestored(t *testing.T) {
+	dir := t.TempDir()
+	path, file := filepath.Join(dir, "config.json"), filepath.Join(dir, "default.log")
+	write := func(config string) {
+		if err := os.WriteFile(path, []byte(config), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	out := new(programOutput)
+	l, err := New("%{lvl} %{message}", DefTimeFmt, out, LInfo)
+	if err != nil {
+		t.Fatal(err)
+	}
+	SetDefault(&l)
+	defer SetDefault(nil)
+
+	write(`{"loggers": {"default": {"format": "file %{message}", "level": "debug",
+		"outputs": [{"type": "file", "path": "` + file + `"}]}}}`)
+	w, err := WatchConfig(path, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Close()
+	Debug("one")
+	first := l.OutputWriter().(*os.File)
+
+	write(`{"loggers": {}}`)
+	if err := w.Reload(); err != nil {
+		t.Fatal(err)
+	}
+	Debug("hidden")
+	Info("two")
+	if out.closed {
+		t.Error("The output of the program was closed")
+	}
+	if _, err := first.Write([]byte("x")); !errors.Is(err, os.ErrClosed) {
+		t.Errorf("Output of the Watcher not closed: %v", err)
+	}
+	if l.OutputWriter() != out || l.LogLevel() != LInfo {
+		t.Errorf("Settings not restored: %v %v", l.OutputWriter(), l.LogLevel())
+	}
+	want := "NOT reloaded logging config " + path + ": default removed, back to its settings before the file\nINF two\n"
+	if have := out.String(); want != have {
+		t.Errorf("\nWant: %sHave: %s", want, have)
+	}
+	if b, _ := os.ReadFile(file); string(b) != "file one\n" {
+		t.Errorf("default.log: %q", b)
+	}
+}
+
+func TestReloadSettingsTogether(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "config.json")
+	write := func(name string) {
+		config := `{"loggers": {"app": {"format": "` + name + ` %{message}",
+			"outputs": [{"type": "file", "path": "` + filepath.Join(dir, name) + `"}]}}}`
+		if err := os.WriteFile(path, []byte(config), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write("a")
+	w, err := WatchConfig(path, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Close()
+	notices := new(bytes.Buffer)
+	defer defaultLogger.SetOutput(defaultLogger.worker.setOutput(notices))
+	l := w.Logger("app")
+	stop := make(chan struct{})
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case <-stop:
+					return
+				default:
+					l.Notice("x")
+				}
+			}
+		}()
+	}
+	for i := 0; i < 20; i++ {
+		write([]string{"b", "a"}[i%2])
+		if err := w.Reload(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	close(stop)
+	wg.Wait()
+	closeOutput(l.OutputWriter())
+	for _, name := range []string{"a", "b"} {
+		b, err := os.ReadFile(filepath.Join(dir, name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, line := range strings.Split(strings.TrimSuffix(string(b), "\n"), "\n") {
+			if len(b) == 0 {
+				break
+			}
+			if line != name+" x" {
+				t.Fatalf("%s has a line of other settings: %q", name, line)
+			}
+		}
+	}
+}
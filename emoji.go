@@ -0,0 +1,136 @@
+// COPYRIGHT (c) 2019-2021 SILVANO ZAMPARDI, ALL RIGHTS RESERVED.
+// The license for these sources can be found in the LICENSE file in the root directory of this source tree.
+
+package log
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/szampardi/msg/unicode"
+)
+
+// EmojiTheme maps levels to the emoji shown by %{emoji}, levels missing
+// from a theme keep the emoji of Levels, or the one of SetLevelEmoji
+type EmojiTheme map[Lvl]string
+
+// names of the themes in EmojiThemes
+const (
+	FacesTheme   string = "faces"
+	SymbolsTheme string = "symbols"
+	ASCIITheme   string = "ascii"
+)
+
+var (
+	// EmojiThemes are ready to use themes, faces is the default
+	EmojiThemes = map[string]EmojiTheme{
+		FacesTheme: {
+			LCrit:   unicode.Emoji(":sob:"),
+			LErr:    unicode.Emoji(":rage:"),
+			LWarn:   unicode.Emoji(":triumph:"),
+			LNotice: unicode.Emoji(":smile:"),
+			LInfo:   unicode.Emoji(":yum:"),
+			LDebug:  unicode.Emoji(":confused:"),
+		},
+		SymbolsTheme: {
+			LCrit:   unicode.Emoji(":fire:"),
+			LErr:    unicode.Emoji(":x:"),
+			LWarn:   unicode.Emoji(":warning:"),
+			LNotice: unicode.Emoji(":bell:"),
+			LInfo:   unicode.Emoji(":information_source:"),
+			LDebug:  unicode.Emoji(":bug:"),
+		},
+		// used automatically on terminals without emojis
+		ASCIITheme: {
+			LCrit:   "[!!]",
+			LErr:    "[x]",
+			LWarn:   "[!]",
+			LNotice: "[*]",
+			LInfo:   "[i]",
+			LDebug:  "[.]",
+		},
+	}
+)
+
+// SetEmojiTheme changes the emojis of the Logger, nil goes back to those of the levels
+func (l *Logger) SetEmojiTheme(theme EmojiTheme) {
+	l.worker.theme.Store(theme)
+}
+
+var (
+	levelEmojisMu sync.Mutex   // serializes changes of levelEmojis
+	levelEmojis   atomic.Value // map[Lvl]string of SetLevelEmoji, replaced as a whole
+)
+
+// SetLevelEmoji changes the emoji of a level for every Logger without a theme,
+// emoji is either a name (":warning:", see unicode.Emoji) or the emoji itself.
+// It is safe to call while logging, unlike changing Levels
+func SetLevelEmoji(lvl Lvl, emoji string) error {
+	e := emoji
+	if strings.HasPrefix(emoji, ":") && strings.HasSuffix(emoji, ":") && len(emoji) > 2 {
+		if e = unicode.Emoji(emoji); e == "" {
+			return fmt.Errorf("unknown emoji %s", emoji)
+		}
+	}
+	if _, ok := Levels[lvl]; !ok {
+		return fmt.Errorf("invalid log level %d", lvl)
+	}
+	setLevelEmoji(lvl, e, true)
+	return nil
+}
+
+// set or forget the emoji of lvl set by SetLevelEmoji
+func setLevelEmoji(lvl Lvl, e string, set bool) {
+	levelEmojisMu.Lock()
+	defer levelEmojisMu.Unlock()
+	old, _ := levelEmojis.Load().(map[Lvl]string)
+	m := make(map[Lvl]string, len(old)+1)
+	for k, v := range old {
+		m[k] = v
+	}
+	if set {
+		m[lvl] = e
+	} else {
+		delete(m, lvl)
+	}
+	levelEmojis.Store(m)
+}
+
+// the emoji of lvl without a theme
+func levelEmoji(lvl Lvl) string {
+	if m, _ := levelEmojis.Load().(map[Lvl]string); m != nil {
+		if e, ok := m[lvl]; ok {
+			return e
+		}
+	}
+	return Levels[lvl].emoji
+}
+
+// emoji of lvl for this worker, plain text on terminals without emojis
+func (w *worker) emoji(lvl Lvl) string {
+	theme, _ := w.theme.Load().(EmojiTheme)
+	e, ok := theme[lvl]
+	if !ok {
+		e = levelEmoji(lvl)
+	}
+	if atomic.LoadUint32(&w.asciiEmoji) == 1 {
+		if a, ok := EmojiThemes[ASCIITheme][lvl]; ok {
+			return a
+		}
+		return unicode.ASCII(e)
+	}
+	return e
+}
+
+// emojis are replaced when writing to a terminal that cannot show them
+func (w *worker) checkEmoji(out io.Writer) {
+	var ascii uint32
+	if f, ok := out.(*os.File); ok && isTerminal(f) && !unicode.Supported() {
+		ascii = 1
+	}
+	atomic.StoreUint32(&w.asciiEmoji, ascii)
+}
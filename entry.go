@@ -0,0 +1,104 @@
+// COPYRIGHT (c) 2019-2021 SILVANO ZAMPARDI, ALL RIGHTS RESERVED.
+// The license for these sources can be found in the LICENSE file in the root directory of this source tree.
+
+package log
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// Fields are key/value pairs attached to the entries of a Logger
+type Fields map[string]interface{}
+
+// WithFields returns a copy of the Logger adding fields to its entries, they are
+// rendered by %{fields}, in the json format and passed to EntryWriters.
+// The copy shares output, format and level with l
+func (l *Logger) WithFields(fields Fields) *Logger {
+	c := *l
+	c.fields = make(Fields, len(l.fields)+len(fields))
+	for k, v := range l.fields {
+		c.fields[k] = v
+	}
+	for k, v := range fields {
+		c.fields[k] = v
+	}
+	return &c
+}
+
+// Entry is a log entry as received by an EntryWriter. Fields must not be modified
+type Entry struct {
+	ID      string // "" with IDNone
+	Time    time.Time
+	Module  string
+	Level   Lvl
+	Message string
+	Fields  Fields
+	File    string // base name
+	Path    string
+	Line    int
+	Func    string
+	Package string
+}
+
+// EntryWriter is implemented by outputs that want entries with their details (level,
+// fields...) rather than just lines: when the output of a Logger is an EntryWriter,
+// WriteEntry is called in place of Write with the entry and its formatted line
+type EntryWriter interface {
+	io.Writer
+	WriteEntry(e *Entry, p []byte) (int, error)
+}
+
+func (r *info) entry() Entry {
+	return Entry{
+		ID:      string(r.id[:r.idLen]),
+		Time:    r.when,
+		Module:  r.Module,
+		Level:   r.Level,
+		Message: string(appendValue(nil, r.Message)),
+		Fields:  r.Fields,
+		File:    r.Filename,
+		Path:    r.Path,
+		Line:    r.Line,
+		Func:    r.Func,
+		Package: r.Package,
+	}
+}
+
+// append fields as key=value pairs sorted by key, values with spaces are quoted
+func appendFields(dst []byte, fields Fields) []byte {
+	keys := make([]string, 0, len(fields))
+	for k := range fields {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for i, k := range keys {
+		if i > 0 {
+			dst = append(dst, ' ')
+		}
+		dst = append(dst, k...)
+		dst = append(dst, '=')
+		v := fmt.Sprint(fields[k])
+		if needsQuotes(v) {
+			dst = strconv.AppendQuote(dst, v)
+		} else {
+			dst = append(dst, v...)
+		}
+	}
+	return dst
+}
+
+func needsQuotes(s string) bool {
+	if s == "" {
+		return true
+	}
+	for _, c := range s {
+		if c <= ' ' || c == '"' || c == '=' || c == 0x7f {
+			return true
+		}
+	}
+	return false
+}
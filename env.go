@@ -0,0 +1,139 @@
+// COPYRIGHT (c) 2019-2021 SILVANO ZAMPARDI, ALL RIGHTS RESERVED.
+// The license for these sources can be found in the LICENSE file in the root directory of this source tree.
+
+package log
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// Environment variables configuring the default Logger, read when the package is
+// initialized: anything set by the program afterwards (SetFormat, SetOutput...) wins.
+// Call LoadEnv to apply them again, over what the program set
+const (
+	EnvFormat     = "MSG_FORMAT"      // a name of Formats or a format
+	EnvTimeFormat = "MSG_TIME_FORMAT" // a name of Formats or a time layout
+	EnvLevel      = "MSG_LEVEL"       // crit, error, warn, notice, info, debug or a number
+	EnvColor      = "MSG_COLOR"       // auto, always or never
+	EnvOutput     = "MSG_OUTPUT"      // stdout, stderr or the path of a file to append to
+	EnvModule     = "MSG_MODULE"
+)
+
+func init() {
+	if err := LoadEnv(); err != nil {
+		fmt.Fprintf(os.Stderr, "msg: %s\n", err)
+	}
+}
+
+// LoadEnv configures the default Logger from the environment variables, invalid
+// ones are ignored and reported in the error
+func LoadEnv() error {
+	return loadEnv(Default(), os.Getenv)
+}
+
+func loadEnv(l *Logger, getenv func(string) string) error {
+	var errs []string
+	invalid := func(name, value string, err error) {
+		errs = append(errs, fmt.Sprintf("invalid %s %q: %s", name, value, err))
+	}
+	if v := getenv(EnvModule); v != "" {
+		l.Module = v
+	}
+	if v := getenv(EnvLevel); v != "" {
+		if lvl, err := ParseLevel(v); err != nil {
+			invalid(EnvLevel, v, err)
+		} else {
+			l.worker.setLogLevel(lvl)
+		}
+	}
+	format, timeformat := getenv(EnvFormat), getenv(EnvTimeFormat)
+	if format != "" || timeformat != "" {
+		current := l.worker.getFormat()
+		if format == "" {
+			format = current.source
+		}
+		if timeformat == "" {
+			timeformat = current.timeSource
+		}
+		if f, err := newFormatter(format, timeformat); err != nil {
+			invalid(EnvFormat, format, err)
+		} else {
+			l.worker.setFormat(f)
+		}
+	}
+	out := l.worker.Minion.Writer()
+	if v := getenv(EnvOutput); v != "" {
+		if w, err := openOutput(v); err != nil {
+			invalid(EnvOutput, v, err)
+		} else {
+			out = w
+			l.worker.setOpenedOutput(w) // closed if the program replaces it
+		}
+	}
+	if v := getenv(EnvColor); v != "" {
+		if mode, err := ParseColorMode(v); err != nil {
+			invalid(EnvColor, v, err)
+		} else {
+			l.worker.setColor(mode, out)
+		}
+	}
+	if len(errs) > 0 {
+		return fmt.Errorf("%s", strings.Join(errs, "; "))
+	}
+	return nil
+}
+
+// stdout, stderr or a file opened for appending
+func openOutput(v string) (io.Writer, error) {
+	switch strings.ToLower(v) {
+	case "stdout":
+		return os.Stdout, nil
+	case "stderr":
+		return os.Stderr, nil
+	}
+	return os.OpenFile(v, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+}
+
+// ParseLevel parses the name of a level ("error", "WARN", "warning"...) or its number
+func ParseLevel(s string) (Lvl, error) {
+	if lvl, ok := levelTokens[strings.ToLower(s)]; ok {
+		return lvl, nil
+	}
+	for lvl, level := range Levels {
+		if strings.EqualFold(level.Str, s) {
+			return lvl, nil
+		}
+	}
+	i, err := strconv.Atoi(s)
+	if err != nil {
+		return 0, fmt.Errorf("unknown log level")
+	}
+	if _, ok := Levels[Lvl(i)]; !ok {
+		return 0, fmt.Errorf("invalid log level %d", i)
+	}
+	return Lvl(i), nil
+}
+
+// ParseColorMode parses auto, always or never, booleans are always and never
+func ParseColorMode(s string) (ColorMode, error) {
+	switch strings.ToLower(s) {
+	case "auto":
+		return ColorAuto, nil
+	case "always", "force":
+		return ColorAlways, nil
+	case "never", "none":
+		return ColorNever, nil
+	}
+	b, err := strconv.ParseBool(s)
+	if err != nil {
+		return ColorAuto, fmt.Errorf("expected auto, always or never")
+	}
+	if b {
+		return ColorAlways, nil
+	}
+	return ColorNever, nil
+}
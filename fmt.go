@@ -4,7 +4,8 @@
 package log
 
 import (
-	"strings"
+	"fmt"
+	"sync/atomic"
 	"time"
 )
 
@@ -25,6 +26,12 @@ const ( //  https://golang.org/src/time/format.go
 	DefTimeFmt string = "rfc3339"
 	// DetailedTimeFmt has nanoseconds
 	DetailedTimeFmt string = "rfc3339Nano"
+	// UnixTimeFmt seconds since the Unix epoch, a number in JSON
+	UnixTimeFmt string = "unix"
+	// UnixMilliTimeFmt milliseconds since the Unix epoch, a number in JSON
+	UnixMilliTimeFmt string = "unixms"
+	// UnixNanoTimeFmt nanoseconds since the Unix epoch, a number in JSON
+	UnixNanoTimeFmt string = "unixns"
 	// CLIFormat  command line interface
 	CLIFormat string = "cli"
 	// PlainFormat just print message
@@ -56,6 +63,18 @@ var (
 			Name:    DetailedTimeFmt,
 			_String: time.RFC3339Nano,
 		},
+		UnixTimeFmt: {
+			Name:    UnixTimeFmt,
+			_String: UnixTimeFmt,
+		},
+		UnixMilliTimeFmt: {
+			Name:    UnixMilliTimeFmt,
+			_String: UnixMilliTimeFmt,
+		},
+		UnixNanoTimeFmt: {
+			Name:    UnixNanoTimeFmt,
+			_String: UnixNanoTimeFmt,
+		},
 		CLIFormat: {
 			Name:    CLIFormat,
 			_String: "%[3]s\t%[2]s\n\t%[7]s\n\n",
@@ -87,127 +106,199 @@ var (
 	}
 )
 
-var (
-	logNo            uint32
-	activeFormat     string = Formats[PlainFormat]._String
-	activeTimeFormat string = Formats[DefTimeFmt]._String
-)
+var logNo uint64 // the counter of IDGlobal, accessed atomically
 
-// SetDefaultFormat used to
-func SetDefaultFormat() {
-	activeFormat, activeTimeFormat = parseFormat(Formats[CLIFormat]._String)
+// formats of the Loggers created without one, see SetDefaultFormat
+type formatDefaults struct {
+	format, timeFormat string
+	loc                *time.Location
 }
 
-func (w *worker) setFormat(format, timeformat string) {
-	w.format, w.timeFormat = format, timeformat
+var defaultFormats atomic.Value // formatDefaults
+
+func getDefaultFormats() formatDefaults {
+	if d, ok := defaultFormats.Load().(formatDefaults); ok {
+		return d
+	}
+	return formatDefaults{format: Formats[PlainFormat]._String, timeFormat: Formats[DefTimeFmt]._String}
 }
 
-// SetFormat ...
-func (l *Logger) SetFormat(format string) {
-	activeFormat, activeTimeFormat = parseFormat(format)
-	l.worker.setFormat(activeFormat, activeTimeFormat)
+// SetDefaultFormat changes the format of the Loggers created afterwards without one,
+// existing Loggers keep theirs. format is a name of Formats or a format, like SetFormat
+func SetDefaultFormat(format string) error {
+	d := getDefaultFormats()
+	if _, err := newFormatter(format, d.timeFormat); err != nil {
+		return err
+	}
+	d.format = format
+	defaultFormats.Store(d)
+	return nil
 }
 
-func (w *worker) setLogLevel(level Lvl) {
-	w.level = level
+// SetDefaultTimeFormat changes the time format of the Loggers created afterwards without one,
+// a name of Formats or a time layout
+func SetDefaultTimeFormat(timeformat string) error {
+	d := getDefaultFormats()
+	if _, err := newFormatter(d.format, timeformat); err != nil {
+		return err
+	}
+	d.timeFormat = timeformat
+	defaultFormats.Store(d)
+	return nil
 }
 
-// SetLogLevel to change verbosity
-func (l *Logger) SetLogLevel(level Lvl) {
-	l.worker.level = level
+// SetDefaultLocation makes the Loggers created afterwards write times in loc, like
+// SetLocation, existing Loggers keep theirs. nil is the local time zone
+func SetDefaultLocation(loc *time.Location) {
+	d := getDefaultFormats()
+	d.loc = loc
+	defaultFormats.Store(d)
 }
 
-var (
-	fmtPlaceholders = map[string]string{
-		"%{id}":       "%[1]d",
-		"%{time}":     "%[2]s",
-		"%{module}":   "%[3]s",
-		"%{filename}": "%[4]s",
-		"%{file}":     "%[4]s",
-		"%{line}":     "%[5]d",
-		"%{level}":    "%[6]s",
-		"%{lvl}":      "%.3[6]s",
-		"%{message}":  "%[7]s",
-		//"%{emoji}":  "%[8]s", // added after
-	}
-)
+// formatter is the output format of a worker, replaced as a whole so that
+// changing format while logging is safe
+type formatter struct {
+	source     string
+	timeSource string // the time format asked for, timeFormat may come from the template
+	spFormat   string
+	tmpl       *template
+	timeFormat string
+}
 
-// Analyze and represent format string as printf format string and time format
-func parseFormat(format string) (msgfmt, timefmt string) {
-	if len(format) < 10 /* (len of "%{message} */ {
-		return activeFormat, activeTimeFormat
-	}
-	timefmt = activeTimeFormat
-	idx := strings.IndexRune(format, '%')
-	for idx != -1 {
-		msgfmt += format[:idx]
-		format = format[idx:]
-		if len(format) > 2 {
-			if format[1] == '{' {
-				// end of curr verb pos
-				if jdx := strings.IndexRune(format, '}'); jdx != -1 {
-					// next verb pos
-					idx = strings.Index(format[1:], "%{")
-					// incorrect verb found ("...%{wefwef ...") but after
-					// this, new verb (maybe) exists ("...%{inv %{verb}...")
-					if idx != -1 && idx < jdx {
-						msgfmt += "%%"
-						format = format[1:]
-						continue
-					}
-					// get verb and arg
-					verb, arg := ph2verb(format[:jdx+1])
-					msgfmt += verb
-					// check if verb is time
-					// here you can handle args for other verbs
-					if verb == `%[2]s` && arg != "" /* %{time} */ {
-						timefmt = arg
-					}
-					format = format[jdx+1:]
-				} else {
-					format = format[1:]
-				}
-			} else {
-				msgfmt += "%%"
-				format = format[1:]
-			}
+// newFormatter resolves format names and compiles templates, timeformat can be a layout
+// or the name of a time format in Formats. Empty ones are the defaults, see SetDefaultFormat
+func newFormatter(format, timeformat string) (*formatter, error) {
+	if format == "" || timeformat == "" {
+		d := getDefaultFormats()
+		if format == "" {
+			format = d.format
+		}
+		if timeformat == "" {
+			timeformat = d.timeFormat
 		}
-		idx = strings.IndexRune(format, '%')
 	}
-	msgfmt += format
-	return
+	f := &formatter{source: format, timeSource: timeformat, timeFormat: timeLayout(timeformat)}
+	if format == JSONFormat {
+		f.spFormat = "json"
+	}
+	v, named := Formats[format]
+	if named {
+		format = v._String
+	}
+	tmpl, err := compileFormat(format)
+	if err != nil {
+		return nil, err
+	}
+	// most likely a misspelled name, rather than a constant line
+	if !named && tmpl.literal() {
+		return nil, fmt.Errorf("unknown format %q: not a name of Formats and without placeholders", format)
+	}
+	f.tmpl = tmpl
+	if tmpl.timeFormat != "" {
+		f.timeFormat = tmpl.timeFormat
+	}
+	if f.timeFormat == "" {
+		f.timeFormat = time.RFC3339
+	}
+	return f, nil
+}
+
+func (w *worker) setFormat(f *formatter) {
+	w.formatter.Store(f)
+}
+
+func (w *worker) getFormat() *formatter {
+	return w.formatter.Load().(*formatter)
+}
+
+// SetFormat changes the format of the Logger and no other: a name of Formats ("std", "json"...),
+// a printf format of the fields like the ones of Formats, or a %{} template (see docs/formatting.md).
+// format is parsed once, invalid or unknown placeholders, and formats that are neither a name
+// nor have placeholders (a misspelled name like "jsn"), are reported in the returned error
+// and leave the Logger unchanged
+func (l *Logger) SetFormat(format string) error {
+	if format == "" {
+		return fmt.Errorf("empty format")
+	}
+	f, err := newFormatter(format, l.worker.getFormat().timeSource)
+	if err != nil {
+		return err
+	}
+	l.worker.setFormat(f)
+	return nil
+}
+
+// Format returns the format of the Logger, as given to New or SetFormat
+func (l *Logger) Format() string {
+	return l.worker.getFormat().source
 }
 
-// translate format placeholder to printf verb and some argument of placeholder
-// (now used only as time format)
-func ph2verb(ph string) (verb string, arg string) {
-	n := len(ph)
-	if n < 4 {
-		return ``, ``
+// SetTimeFormat changes the time format of the Logger, a name of Formats or a time layout.
+// Formats with their own time layout, like "%{time:15:04:05}", keep it
+func (l *Logger) SetTimeFormat(timeformat string) error {
+	if timeformat == "" {
+		return fmt.Errorf("empty time format")
 	}
-	if ph[0] != '%' || ph[1] != '{' || ph[n-1] != '}' {
-		return ``, ``
+	f, err := newFormatter(l.worker.getFormat().source, timeformat)
+	if err != nil {
+		return err
 	}
-	idx := strings.IndexRune(ph, ':')
-	if idx == -1 {
-		return fmtPlaceholders[ph], ``
+	l.worker.setFormat(f)
+	return nil
+}
+
+// TimeFormat returns the time layout of the Logger
+func (l *Logger) TimeFormat() string {
+	return l.worker.getFormat().timeFormat
+}
+
+func (w *worker) setLogLevel(level Lvl) {
+	atomic.StoreInt32(&w.outLevel, int32(level))
+	w.updateLevel()
+}
+
+// entries are built up to the output level, or the level of the ring buffer if higher
+func (w *worker) updateLevel() {
+	level := Lvl(atomic.LoadInt32(&w.outLevel))
+	if r := w.ringBuffer(); r != nil && r.level > level {
+		level = r.level
 	}
-	verb = fmtPlaceholders[ph[:idx]+"}"]
-	arg = ph[idx+1 : n-1]
-	return
+	atomic.StoreInt32(&w.level, int32(level))
+}
+
+func (w *worker) ringBuffer() *RingBuffer {
+	r, _ := w.ring.Load().(*RingBuffer)
+	return r
+}
+
+// SetLogLevel to change verbosity
+func (l *Logger) SetLogLevel(level Lvl) {
+	l.worker.setLogLevel(level)
+}
+
+// LogLevel returns the verbosity of the Logger, a RingBuffer may record more
+func (l *Logger) LogLevel() Lvl {
+	return Lvl(atomic.LoadInt32(&l.worker.outLevel))
 }
 
 // Info class, Contains all the info on what has to logged, time is the current time, Module is the specific module
 // For which we are logging, level is the state, importance and type of message logged,
 // Message contains the string to be logged, format is the format of string to be passed to sprintf
 type info struct {
-	ID       uint32      `json:"id"`
-	Time     string      `json:"time"`
+	ID       interface{} `json:"id,omitempty"` // set for JSON, a number or a string for ULIDs
+	Time     interface{} `json:"time"`         // a string, or a number for the Unix time formats
 	Module   string      `json:"module"`
 	Level    Lvl         `json:"level"`
 	Line     int         `json:"line,omitempty"`
 	Filename string      `json:"filename,omitempty"`
+	Func     string      `json:"func,omitempty"`
+	Package  string      `json:"-"`
+	Path     string      `json:"-"`
 	Message  interface{} `json:"message"`
+	Fields   Fields      `json:"fields,omitempty"`
 	Emoji    string      `json:"-"`
 	//format   string
+	when  time.Time
+	id    [ulidLen]byte // the ID as text, see IDMode
+	idLen uint8
 }
@@ -0,0 +1,308 @@
+// COPYRIGHT (c) 2019-2021 SILVANO ZAMPARDI, ALL RIGHTS RESERVED.
+// The license for these sources can be found in the LICENSE file in the root directory of this source tree.
+
+package log
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// HTTPEncoding is how a batch of entries is encoded in a request body
+type HTTPEncoding int
+
+// HTTP encodings
+const (
+	NDJSON    HTTPEncoding = iota // one JSON entry per line, application/x-ndjson
+	JSONArray                     // a JSON array of entries, application/json
+)
+
+// defaults of HTTPConfig
+const (
+	DefaultHTTPBatchSize  = 100
+	DefaultHTTPBatchBytes = 1 << 20
+	DefaultHTTPInterval   = time.Second
+	DefaultHTTPQueue      = 10000
+	DefaultHTTPRetries    = 5
+)
+
+// HTTPConfig configures an HTTPWriter, only URL is needed
+type HTTPConfig struct {
+	URL        string
+	Method     string            // POST by default
+	Headers    map[string]string // added to every request, like Authorization
+	Encoding   HTTPEncoding
+	Gzip       bool          // compress request bodies
+	BatchSize  int           // entries per request, DefaultHTTPBatchSize by default
+	BatchBytes int           // bytes of entries per request, DefaultHTTPBatchBytes by default
+	Interval   time.Duration // longest wait before sending a partial batch, DefaultHTTPInterval by default
+	QueueSize  int           // entries waiting for a batch, DefaultHTTPQueue by default, newer entries are dropped when full
+	Retries    int           // attempts after the first one, on errors and 5xx or 429 responses, DefaultHTTPRetries by default, negative for none
+	RetryMin   time.Duration // first delay before retrying, DefaultRetryMin by default
+	RetryMax   time.Duration // longest delay before retrying, DefaultRetryMax by default
+	Client     *http.Client  // http.DefaultClient by default
+}
+
+// HTTPWriter posts batches of entries to an HTTP endpoint, set it as the output of a
+// Logger with the json format: lines that are not valid JSON are sent as JSON strings.
+// Writes never block, batches are sent in the background and retried with a backoff
+// on network errors, 5xx and 429 responses (honouring Retry-After, up to RetryMax)
+type HTTPWriter struct {
+	cfg      HTTPConfig
+	queue    chan []byte
+	closing  chan struct{}
+	done     chan struct{}
+	mu       sync.RWMutex // held by Close, so no Write queues after the last entries are sent
+	closed   bool
+	sent     uint64
+	dropped  uint64
+	inFlight int64
+}
+
+// NewHTTPWriter starts an HTTPWriter
+func NewHTTPWriter(cfg HTTPConfig) (*HTTPWriter, error) {
+	req, err := http.NewRequest(cfg.Method, cfg.URL, nil)
+	if err != nil {
+		return nil, err
+	}
+	if req.URL.Scheme != "http" && req.URL.Scheme != "https" {
+		return nil, fmt.Errorf("unsupported url %q", cfg.URL)
+	}
+	if cfg.Method == "" {
+		cfg.Method = http.MethodPost
+	}
+	if cfg.BatchSize <= 0 {
+		cfg.BatchSize = DefaultHTTPBatchSize
+	}
+	if cfg.BatchBytes <= 0 {
+		cfg.BatchBytes = DefaultHTTPBatchBytes
+	}
+	if cfg.Interval <= 0 {
+		cfg.Interval = DefaultHTTPInterval
+	}
+	if cfg.QueueSize <= 0 {
+		cfg.QueueSize = DefaultHTTPQueue
+	}
+	if cfg.Retries == 0 {
+		cfg.Retries = DefaultHTTPRetries
+	}
+	if cfg.Client == nil {
+		cfg.Client = http.DefaultClient
+	}
+	h := &HTTPWriter{
+		cfg:     cfg,
+		queue:   make(chan []byte, cfg.QueueSize),
+		closing: make(chan struct{}),
+		done:    make(chan struct{}),
+	}
+	go h.run()
+	return h, nil
+}
+
+// Write queues p, dropping it when the queue is full. It fails only after Close
+func (h *HTTPWriter) Write(p []byte) (int, error) {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	if h.closed {
+		return 0, ErrClosed
+	}
+	entry := bytes.TrimRight(p, "\r\n")
+	if json.Valid(entry) {
+		entry = append([]byte(nil), entry...)
+	} else {
+		entry, _ = json.Marshal(string(entry))
+	}
+	select {
+	case h.queue <- entry:
+	default:
+		atomic.AddUint64(&h.dropped, 1)
+	}
+	return len(p), nil
+}
+
+// Stats returns the counters of h
+func (h *HTTPWriter) Stats() NetStats {
+	return NetStats{
+		Sent:    atomic.LoadUint64(&h.sent),
+		Dropped: atomic.LoadUint64(&h.dropped),
+		Queued:  len(h.queue) + int(atomic.LoadInt64(&h.inFlight)),
+	}
+}
+
+// Close sends the entries queued, without retrying, and stops h
+func (h *HTTPWriter) Close() error {
+	h.mu.Lock()
+	if !h.closed {
+		h.closed = true
+		close(h.closing)
+	}
+	h.mu.Unlock()
+	<-h.done
+	return nil
+}
+
+// the sender
+func (h *HTTPWriter) run() {
+	defer close(h.done)
+	var (
+		batch [][]byte
+		size  int
+		timer = time.NewTimer(h.cfg.Interval)
+	)
+	timer.Stop()
+	flush := func(retry bool) {
+		if len(batch) > 0 {
+			h.send(batch, retry)
+			batch, size = batch[:0], 0
+		}
+		atomic.StoreInt64(&h.inFlight, 0)
+	}
+	for {
+		select {
+		case entry := <-h.queue:
+			if len(batch) > 0 && size+len(entry) > h.cfg.BatchBytes {
+				flush(true)
+			}
+			if len(batch) == 0 {
+				timer.Reset(h.cfg.Interval)
+			}
+			batch = append(batch, entry)
+			size += len(entry) + 1
+			atomic.StoreInt64(&h.inFlight, int64(len(batch)))
+			if len(batch) >= h.cfg.BatchSize || size >= h.cfg.BatchBytes {
+				timer.Stop()
+				flush(true)
+			}
+		case <-timer.C:
+			flush(true)
+		case <-h.closing:
+			for {
+				select {
+				case entry := <-h.queue:
+					if len(batch) > 0 && (len(batch) >= h.cfg.BatchSize || size+len(entry) > h.cfg.BatchBytes) {
+						flush(false)
+					}
+					batch = append(batch, entry)
+					size += len(entry) + 1
+				default:
+					flush(false)
+					return
+				}
+			}
+		}
+	}
+}
+
+// post a batch, retrying unless closing
+func (h *HTTPWriter) send(batch [][]byte, retry bool) {
+	body, err := h.encode(batch)
+	if err != nil {
+		atomic.AddUint64(&h.dropped, uint64(len(batch)))
+		return
+	}
+	b := newBackoff(h.cfg.RetryMin, h.cfg.RetryMax)
+	for attempt := 0; ; attempt++ {
+		again, wait := h.post(body)
+		if !again {
+			if wait < 0 {
+				atomic.AddUint64(&h.dropped, uint64(len(batch)))
+			} else {
+				atomic.AddUint64(&h.sent, uint64(len(batch)))
+			}
+			return
+		}
+		if !retry || attempt >= h.cfg.Retries {
+			atomic.AddUint64(&h.dropped, uint64(len(batch)))
+			return
+		}
+		now := time.Now()
+		b.fail(now)
+		if wait <= 0 {
+			wait = b.wait(now)
+		} else if wait > b.max {
+			wait = b.max // a collector cannot stall the writer
+		}
+		select {
+		case <-time.After(wait):
+		case <-h.closing:
+			retry = false
+		}
+	}
+}
+
+// post the body once. again reports whether to retry, after wait if the server said
+// so; a negative wait means the batch was rejected for good
+func (h *HTTPWriter) post(body []byte) (again bool, wait time.Duration) {
+	req, err := http.NewRequest(h.cfg.Method, h.cfg.URL, bytes.NewReader(body))
+	if err != nil {
+		return false, -1
+	}
+	if h.cfg.Encoding == JSONArray {
+		req.Header.Set("Content-Type", "application/json")
+	} else {
+		req.Header.Set("Content-Type", "application/x-ndjson")
+	}
+	if h.cfg.Gzip {
+		req.Header.Set("Content-Encoding", "gzip")
+	}
+	for k, v := range h.cfg.Headers {
+		req.Header.Set(k, v)
+	}
+	resp, err := h.cfg.Client.Do(req)
+	if err != nil {
+		return true, 0
+	}
+	io.Copy(io.Discard, resp.Body)
+	resp.Body.Close()
+	switch {
+	case resp.StatusCode == http.StatusTooManyRequests, resp.StatusCode >= 500:
+		if s, err := strconv.Atoi(resp.Header.Get("Retry-After")); err == nil && s > 0 {
+			wait = time.Duration(s) * time.Second
+		}
+		return true, wait
+	case resp.StatusCode >= 300:
+		return false, -1
+	}
+	return false, 0
+}
+
+func (h *HTTPWriter) encode(batch [][]byte) ([]byte, error) {
+	var buf bytes.Buffer
+	var w io.Writer = &buf
+	var zw *gzip.Writer
+	if h.cfg.Gzip {
+		zw = gzip.NewWriter(&buf)
+		w = zw
+	}
+	var sep []byte
+	if h.cfg.Encoding == JSONArray {
+		w.Write([]byte{'['})
+		sep = []byte{','}
+	}
+	for i, entry := range batch {
+		if i > 0 && sep != nil {
+			w.Write(sep)
+		}
+		w.Write(entry)
+		if sep == nil {
+			w.Write([]byte{'\n'})
+		}
+	}
+	if sep != nil {
+		w.Write([]byte{']'})
+	}
+	if zw != nil {
+		if err := zw.Close(); err != nil {
+			return nil, err
+		}
+	}
+	return buf.Bytes(), nil
+}
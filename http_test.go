@@ -0,0 +1,151 @@
+// COPYRIGHT (c) 2019-2021 SILVANO ZAMPARDI, ALL RIGHTS RESERVED.
+// The license for these sources can be found in the LICENSE file in the root directory of this source tree.
+
+package log
+
+import (
+	"compress/gzip"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+type collector struct {
+	mu       sync.Mutex
+	bodies   []string
+	statuses []int // answered in order, then 200
+}
+
+func (c *collector) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var body io.Reader = r.Body
+	if r.Header.Get("Content-Encoding") == "gzip" {
+		zr, err := gzip.NewReader(r.Body)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		body = zr
+	}
+	b, _ := io.ReadAll(body)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	status := http.StatusOK
+	if len(c.statuses) > 0 {
+		status, c.statuses = c.statuses[0], c.statuses[1:]
+	}
+	if status == http.StatusTooManyRequests {
+		w.Header().Set("Retry-After", "3600") // longer than the tests, RetryMax applies
+	}
+	if status == http.StatusOK {
+		c.bodies = append(c.bodies, r.Header.Get("Content-Type")+" "+r.Header.Get("X-Token")+"\n"+string(b))
+	}
+	w.WriteHeader(status)
+}
+
+func (c *collector) received() []string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return append([]string(nil), c.bodies...)
+}
+
+func TestHTTPWriter(t *testing.T) {
+	c := &collector{}
+	srv := httptest.NewServer(c)
+	defer srv.Close()
+	w, err := NewHTTPWriter(HTTPConfig{URL: srv.URL, Headers: map[string]string{"X-Token": "secret"}, Gzip: true, BatchSize: 2, Interval: time.Hour})
+	if err != nil {
+		t.Fatal(err)
+	}
+	log, err := New(JSONFormat, DefTimeFmt, "http", w, false, LDebug)
+	if err != nil {
+		t.Fatal(err)
+	}
+	log.SetCallerLookup(false)
+	for _, m := range []string{"one", "two", "three"} {
+		log.Info(m)
+	}
+	// the third entry waits for a full batch or Close
+	w.Write([]byte("plain text\n"))
+	w.Close()
+	have := c.received()
+	if len(have) != 2 {
+		t.Fatalf("Expected 2 batches, got %d: %q", len(have), have)
+	}
+	for i, want := range []string{`"message":"one"`, `"message":"two"`, `"message":"three"`} {
+		if body := have[i/2]; !strings.Contains(body, want) {
+			t.Errorf("Missing %s in batch %d: %s", want, i/2, body)
+		}
+	}
+	if want := "application/x-ndjson secret\n"; have[0][:len(want)] != want {
+		t.Errorf("Wrong headers: %q", have[0])
+	}
+	if !strings.Contains(have[1], "}\n\"plain text\"\n") {
+		t.Errorf("Text lines should be sent as JSON strings: %q", have[1])
+	}
+	if stats := w.Stats(); stats.Sent != 4 || stats.Dropped != 0 || stats.Queued != 0 {
+		t.Errorf("Unexpected stats %+v", stats)
+	}
+}
+
+func TestHTTPWriterRetry(t *testing.T) {
+	c := &collector{statuses: []int{http.StatusServiceUnavailable, http.StatusTooManyRequests, http.StatusOK, http.StatusBadRequest}}
+	srv := httptest.NewServer(c)
+	defer srv.Close()
+	w, err := NewHTTPWriter(HTTPConfig{URL: srv.URL, Encoding: JSONArray, Interval: 10 * time.Millisecond, RetryMin: time.Millisecond, RetryMax: time.Millisecond})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Close()
+	w.Write([]byte(`{"n":1}`))
+	w.Write([]byte(`{"n":2}`))
+	deadline := time.Now().Add(5 * time.Second)
+	for w.Stats().Sent != 2 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	if have, want := c.received(), []string{"application/json \n[{\"n\":1},{\"n\":2}]"}; len(have) != 1 || have[0] != want[0] {
+		t.Errorf("\nWant: %q\nHave: %q", want, have)
+	}
+	// client errors are not retried
+	w.Write([]byte(`{"n":3}`))
+	for w.Stats().Dropped != 1 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	if stats := w.Stats(); stats.Sent != 2 || stats.Dropped != 1 {
+		t.Errorf("Unexpected stats %+v", stats)
+	}
+}
+
+func TestHTTPWriterCloseWhileWriting(t *testing.T) {
+	srv := httptest.NewServer(&collector{})
+	defer srv.Close()
+	w, err := NewHTTPWriter(HTTPConfig{URL: srv.URL, BatchSize: 10, Interval: time.Millisecond})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var accepted uint64
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				if _, err := w.Write([]byte(`{"n":1}`)); err != nil {
+					return
+				}
+				atomic.AddUint64(&accepted, 1)
+			}
+		}()
+	}
+	time.Sleep(5 * time.Millisecond)
+	w.Close()
+	wg.Wait()
+	// every entry accepted is sent or counted as dropped
+	if stats := w.Stats(); stats.Sent+stats.Dropped != accepted || stats.Queued != 0 {
+		t.Errorf("Accepted %d entries, stats %+v", accepted, stats)
+	}
+}
@@ -0,0 +1,99 @@
+// COPYRIGHT (c) 2019-2021 SILVANO ZAMPARDI, ALL RIGHTS RESERVED.
+// The license for these sources can be found in the LICENSE file in the root directory of this source tree.
+
+package log
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// IDMode decides the IDs of the entries of a Logger, written by %{id} and in JSON
+type IDMode int32
+
+// ID modes, see SetIDMode
+const (
+	IDGlobal  IDMode = iota // a 64 bit counter shared by the Loggers using it, the default
+	IDCounter               // a 64 bit counter of the Logger, shared with its copies (WithFields...)
+	IDULID                  // a ULID: 26 characters unique across processes, sorted by time
+	IDNone                  // no ID, %{id} is empty and JSON has no "id"
+)
+
+// length of a ULID, counters are at most 20 digits
+const ulidLen = 26
+
+// SetIDMode changes how the entries of the Logger are identified
+func (l *Logger) SetIDMode(mode IDMode) {
+	atomic.StoreInt32(&l.worker.idMode, int32(mode))
+}
+
+// SetIDMode changes how the entries of the default Logger are identified
+func SetIDMode(mode IDMode) {
+	Default().SetIDMode(mode)
+}
+
+// give r its ID, after its time
+func (w *worker) nextID(r *info) {
+	var id []byte
+	switch IDMode(atomic.LoadInt32(&w.idMode)) {
+	case IDGlobal:
+		id = strconv.AppendUint(r.id[:0], atomic.AddUint64(&logNo, 1), 10)
+	case IDCounter:
+		id = strconv.AppendUint(r.id[:0], atomic.AddUint64(&w.seq, 1), 10)
+	case IDULID:
+		ulids.next(&r.id, r.when)
+		id = r.id[:]
+	}
+	r.idLen = uint8(len(id))
+}
+
+// ulidGenerator makes ULIDs increasing within a millisecond, as the spec suggests
+type ulidGenerator struct {
+	mu      sync.Mutex
+	ms      uint64
+	entropy [10]byte
+}
+
+var ulids ulidGenerator
+
+func (g *ulidGenerator) next(dst *[ulidLen]byte, t time.Time) {
+	ms := uint64(t.UnixNano() / int64(time.Millisecond))
+	g.mu.Lock()
+	if ms > g.ms {
+		g.ms = ms
+		if _, err := rand.Read(g.entropy[:]); err != nil {
+			g.increment()
+		}
+	} else {
+		g.increment() // same millisecond, or the clock went back
+	}
+	encodeULID(dst, g.ms, &g.entropy)
+	g.mu.Unlock()
+}
+
+func (g *ulidGenerator) increment() {
+	for i := len(g.entropy) - 1; i >= 0; i-- {
+		g.entropy[i]++
+		if g.entropy[i] != 0 {
+			return
+		}
+	}
+	g.ms++ // 80 bits overflowed, borrow the next millisecond
+}
+
+const crockford = "0123456789ABCDEFGHJKMNPQRSTVWXYZ"
+
+// the 48 bit timestamp and 80 bits of entropy in Crockford's base32
+func encodeULID(dst *[ulidLen]byte, ms uint64, entropy *[10]byte) {
+	hi := ms<<16 | uint64(entropy[0])<<8 | uint64(entropy[1])
+	lo := binary.BigEndian.Uint64(entropy[2:])
+	for i := ulidLen - 1; i >= 0; i-- {
+		dst[i] = crockford[lo&31]
+		lo = lo>>5 | hi<<59
+		hi >>= 5
+	}
+}
@@ -0,0 +1,215 @@
+// COPYRIGHT (c) 2019-2021 SILVANO ZAMPARDI, ALL RIGHTS RESERVED.
+// The license for these sources can be found in the LICENSE file in the root directory of this source tree.
+
+package log
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+	"unsafe"
+)
+
+// JournalSocket is where journald receives entries with its native protocol
+var JournalSocket = "/run/systemd/journal/socket"
+
+// JournalWriter sends entries to journald, set it as the output of a Logger.
+// Levels are sent as PRIORITY, the caller as CODE_FILE, CODE_LINE and CODE_FUNC,
+// fields as upper case journal fields ("user" becomes USER). Fields named like the
+// ones the writer sends get a FIELD_ prefix ("message" becomes FIELD_MESSAGE)
+type JournalWriter struct {
+	identifier string
+	conn       *net.UnixConn
+	addr       *net.UnixAddr
+	mu         sync.Mutex
+	buf        []byte
+}
+
+// NewJournalWriter connects to journald, identifier is the SYSLOG_IDENTIFIER
+// of entries, the Module of each entry when empty
+func NewJournalWriter(identifier string) (*JournalWriter, error) {
+	addr := &net.UnixAddr{Name: JournalSocket, Net: "unixgram"}
+	if _, err := os.Stat(addr.Name); err != nil {
+		return nil, err
+	}
+	// not connected, descriptors can only be passed with an address
+	conn, err := net.ListenUnixgram("unixgram", &net.UnixAddr{Net: "unixgram"})
+	if err != nil {
+		return nil, err
+	}
+	return &JournalWriter{identifier: identifier, conn: conn, addr: addr}, nil
+}
+
+// Write sends p as a notice, for use outside of a Logger
+func (j *JournalWriter) Write(p []byte) (int, error) {
+	return j.WriteEntry(&Entry{Time: time.Now(), Level: LNotice, Module: "msg"}, p)
+}
+
+// WriteEntry sends the line p as MESSAGE with the level, caller and fields of e
+func (j *JournalWriter) WriteEntry(e *Entry, p []byte) (int, error) {
+	for len(p) > 0 && p[len(p)-1] == '\n' {
+		p = p[:len(p)-1]
+	}
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	j.buf = j.encode(j.buf[:0], e, p)
+	if _, err := j.conn.WriteToUnix(j.buf, j.addr); err != nil {
+		if !errors.Is(err, syscall.EMSGSIZE) && !errors.Is(err, syscall.ENOBUFS) {
+			return 0, err
+		}
+		// too large for a datagram, pass it in a memory file
+		if err = j.sendFile(); err != nil {
+			return 0, err
+		}
+	}
+	return len(p), nil
+}
+
+// Close closes the connection to journald
+func (j *JournalWriter) Close() error {
+	return j.conn.Close()
+}
+
+func (j *JournalWriter) encode(dst []byte, e *Entry, msg []byte) []byte {
+	identifier := j.identifier
+	if identifier == "" {
+		identifier = e.Module
+	}
+	dst = appendJournalField(dst, "MESSAGE", msg)
+	dst = appendJournalField(dst, "PRIORITY", strconv.AppendInt(nil, int64(SyslogSeverity(e.Level)), 10))
+	dst = appendJournalField(dst, "SYSLOG_IDENTIFIER", []byte(identifier))
+	if e.Path != "" {
+		dst = appendJournalField(dst, "CODE_FILE", []byte(e.Path))
+		dst = appendJournalField(dst, "CODE_LINE", strconv.AppendInt(nil, int64(e.Line), 10))
+	}
+	if e.Func != "" {
+		fn := e.Func
+		if e.Package != "" {
+			fn = e.Package + "." + fn
+		}
+		dst = appendJournalField(dst, "CODE_FUNC", []byte(fn))
+	}
+	keys := make([]string, 0, len(e.Fields))
+	for k := range e.Fields {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		if name := journalFieldName(k); name != "" {
+			dst = appendJournalField(dst, name, []byte(fmt.Sprint(e.Fields[k])))
+		}
+	}
+	return dst
+}
+
+// KEY=value, or KEY, the length as little endian uint64 and the value when it has newlines
+func appendJournalField(dst []byte, name string, value []byte) []byte {
+	dst = append(dst, name...)
+	for _, c := range value {
+		if c == '\n' {
+			dst = append(dst, '\n')
+			var n [8]byte
+			binary.LittleEndian.PutUint64(n[:], uint64(len(value)))
+			dst = append(dst, n[:]...)
+			dst = append(dst, value...)
+			return append(dst, '\n')
+		}
+	}
+	dst = append(dst, '=')
+	dst = append(dst, value...)
+	return append(dst, '\n')
+}
+
+// journal field names are upper case letters, digits and underscores, not starting
+// with an underscore (reserved to journald) or a digit, at most 64 characters.
+// Names of the fields sent by the writer are prefixed, not to send them twice
+func journalFieldName(k string) string {
+	name := make([]byte, 0, len(k))
+	for i := 0; i < len(k) && len(name) < 64; i++ {
+		switch c := k[i]; {
+		case c >= 'a' && c <= 'z':
+			name = append(name, c-'a'+'A')
+		case c >= 'A' && c <= 'Z', c >= '0' && c <= '9' && len(name) > 0:
+			name = append(name, c)
+		case len(name) > 0:
+			name = append(name, '_')
+		}
+	}
+	switch n := string(name); {
+	case n == "MESSAGE", n == "PRIORITY", n == "SYSLOG_IDENTIFIER", strings.HasPrefix(n, "CODE_"):
+		if n = "FIELD_" + n; len(n) > 64 {
+			n = n[:64]
+		}
+		return n
+	default:
+		return n
+	}
+}
+
+// memfd_create is not in syscall for every architecture, these are the numbers of the
+// kernel's syscall tables. Other architectures pass a temporary file
+var memfdCreate = map[string]uintptr{
+	"386":      356,
+	"amd64":    319,
+	"arm":      385,
+	"arm64":    279,
+	"loong64":  279,
+	"mips64":   5314,
+	"mips64le": 5314,
+	"ppc64":    360,
+	"ppc64le":  360,
+	"riscv64":  279,
+	"s390x":    350,
+}
+
+const (
+	fAddSeals = 1033 // F_ADD_SEALS
+	sealAll   = 0xf  // F_SEAL_SEAL, F_SEAL_SHRINK, F_SEAL_GROW, F_SEAL_WRITE
+)
+
+// send the entry in a sealed memfd, or an unlinked file in /dev/shm
+// where memfd is not available, passing only its descriptor
+func (j *JournalWriter) sendFile() error {
+	f, sealed, err := memFile()
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	if _, err = f.Write(j.buf); err != nil {
+		return err
+	}
+	if sealed {
+		if _, _, errno := syscall.Syscall(syscall.SYS_FCNTL, f.Fd(), fAddSeals, sealAll); errno != 0 {
+			return errno
+		}
+	}
+	_, _, err = j.conn.WriteMsgUnix(nil, syscall.UnixRights(int(f.Fd())), j.addr)
+	return err
+}
+
+func memFile() (f *os.File, sealed bool, err error) {
+	if trap, ok := memfdCreate[runtime.GOARCH]; ok {
+		name, _ := syscall.BytePtrFromString("msg-journal")
+		// MFD_CLOEXEC | MFD_ALLOW_SEALING
+		fd, _, errno := syscall.Syscall(trap, uintptr(unsafe.Pointer(name)), 0x1|0x2, 0)
+		if errno == 0 {
+			return os.NewFile(fd, "msg-journal"), true, nil
+		}
+	}
+	for _, dir := range []string{"/dev/shm", os.TempDir()} {
+		if f, err = os.CreateTemp(dir, "msg-journal"); err == nil {
+			os.Remove(f.Name())
+			return f, false, nil
+		}
+	}
+	return nil, false, err
+}
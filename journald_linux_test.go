@@ -0,0 +1,101 @@
+// COPYRIGHT (c) 2019-2021 SILVANO ZAMPARDI, ALL RIGHTS RESERVED.
+// The license for these sources can be found in the LICENSE file in the root directory of this source tree.
+
+package log
+
+import (
+	"bytes"
+	"net"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestJournal(t *testing.T) {
+	socket := filepath.Join(t.TempDir(), "journal.sock")
+	server, err := net.ListenUnixgram("unixgram", &net.UnixAddr{Name: socket, Net: "unixgram"})
+	if err != nil {
+		t.Skip(err)
+	}
+	defer server.Close()
+	defer func(s string) { JournalSocket = s }(JournalSocket)
+	JournalSocket = socket
+	w, err := NewJournalWriter("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Close()
+	log, err := New(PlainFormat, DefTimeFmt, "app", w, false, LDebug)
+	if err != nil {
+		t.Fatal(err)
+	}
+	read := func() []byte {
+		server.SetReadDeadline(time.Now().Add(5 * time.Second))
+		b, oob := make([]byte, 1<<16), make([]byte, 64)
+		n, oobn, _, _, err := server.ReadMsgUnix(b, oob)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if n > 0 {
+			return b[:n]
+		}
+		msgs, err := syscall.ParseSocketControlMessage(oob[:oobn])
+		if err != nil || len(msgs) != 1 {
+			t.Fatalf("Neither data nor a descriptor received: %v", err)
+		}
+		fds, err := syscall.ParseUnixRights(&msgs[0])
+		if err != nil || len(fds) != 1 {
+			t.Fatalf("No descriptor received: %v", err)
+		}
+		f := os.NewFile(uintptr(fds[0]), "entry")
+		defer f.Close()
+		fi, err := f.Stat()
+		if err != nil {
+			t.Fatal(err)
+		}
+		b = make([]byte, fi.Size())
+		if _, err = f.ReadAt(b, 0); err != nil {
+			t.Fatal(err)
+		}
+		return b
+	}
+
+	log.WithFields(Fields{"user": "bob", "_trusted": 1, "request-id": 7, "message": "mine", "code_line": 1}).Warning("hello")
+	have := string(read())
+	for _, want := range []string{"MESSAGE=hello\n", "PRIORITY=4\n", "SYSLOG_IDENTIFIER=app\n", "CODE_FILE=", "journald_linux_test.go\n", "CODE_LINE=", "CODE_FUNC=github.com/szampardi/msg.TestJournal\n", "USER=bob\n", "TRUSTED=1\n", "REQUEST_ID=7\n", "FIELD_MESSAGE=mine\n", "FIELD_CODE_LINE=1\n"} {
+		if !strings.Contains(have, want) {
+			t.Errorf("Missing %q in:\n%s", want, have)
+		}
+	}
+	if strings.Count(have, "MESSAGE=") != 2 || strings.Count(have, "\nCODE_LINE=") != 1 {
+		t.Errorf("Fields sent twice:\n%s", have)
+	}
+
+	log.Error("multi\nline")
+	if have := read(); !bytes.HasPrefix(have, []byte("MESSAGE\n\x0a\x00\x00\x00\x00\x00\x00\x00multi\nline\n")) {
+		t.Errorf("Wrong encoding of a multiline message: %q", have)
+	}
+
+	large := strings.Repeat("x", 1<<20)
+	log.Info(large)
+	if have := read(); !bytes.HasPrefix(have, []byte("MESSAGE="+large+"\nPRIORITY=6\n")) {
+		t.Errorf("Large entry not received, %d bytes", len(have))
+	}
+
+	// architectures without a known memfd_create pass a temporary file
+	trap, ok := memfdCreate[runtime.GOARCH]
+	delete(memfdCreate, runtime.GOARCH)
+	defer func() {
+		if ok {
+			memfdCreate[runtime.GOARCH] = trap
+		}
+	}()
+	log.Info(large)
+	if have := read(); !bytes.HasPrefix(have, []byte("MESSAGE="+large+"\nPRIORITY=6\n")) {
+		t.Errorf("Large entry not received without memfd, %d bytes", len(have))
+	}
+}
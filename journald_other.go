@@ -0,0 +1,37 @@
+// COPYRIGHT (c) 2019-2021 SILVANO ZAMPARDI, ALL RIGHTS RESERVED.
+// The license for these sources can be found in the LICENSE file in the root directory of this source tree.
+
+//go:build !linux
+// +build !linux
+
+package log
+
+import "errors"
+
+// JournalSocket is where journald receives entries with its native protocol
+var JournalSocket = "/run/systemd/journal/socket"
+
+var errNoJournal = errors.New("journald is only available on linux")
+
+// JournalWriter sends entries to journald, only on linux
+type JournalWriter struct{}
+
+// NewJournalWriter fails, journald is only available on linux
+func NewJournalWriter(identifier string) (*JournalWriter, error) {
+	return nil, errNoJournal
+}
+
+// Write fails, journald is only available on linux
+func (j *JournalWriter) Write(p []byte) (int, error) {
+	return 0, errNoJournal
+}
+
+// WriteEntry fails, journald is only available on linux
+func (j *JournalWriter) WriteEntry(e *Entry, p []byte) (int, error) {
+	return 0, errNoJournal
+}
+
+// Close does nothing
+func (j *JournalWriter) Close() error {
+	return nil
+}
@@ -42,12 +42,17 @@ type Level struct {
 }
 
 func initLvl(id int, name, color string, emoji int) Level {
+	c, err := ansi.ParseColor(color)
+	if err != nil {
+		c = ansi.Colors[color] // no color
+	}
+	c = c.Downgrade(ansi.DetectProfile())
 	return Level{
 		ID:           id,
 		Str:          name,
 		emoji:        unicode.CodepageIntToEmoji(emoji),
-		escaped:      ansi.Colors[color].Str,
-		escapedBytes: ansi.Colors[color].Bytes,
+		escaped:      c.Str,
+		escapedBytes: c.Bytes,
 	}
 }
 
@@ -93,7 +98,11 @@ var (
 	}
 )
 
-// SetLevel to create or reconfigure a level
+// SetLevel to create or reconfigure a level. color is anything ansi.ParseColor accepts,
+// "Red", "BrightRed", "208", "#ff8800" or styles like "bold+underline+Red", it is
+// downgraded to what the terminal supports. emoji replaces the one set by SetLevelEmoji,
+// which takes emojis by name
 func SetLevel(id int, name, color string, emoji int) {
 	Levels[Lvl(id)] = initLvl(id, name, color, emoji)
+	setLevelEmoji(Lvl(id), "", false)
 }
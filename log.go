@@ -8,6 +8,7 @@ import (
 	"io"
 	"os"
 	"runtime"
+	"sync/atomic"
 )
 
 // Fatal is just like func l.Critical logger except that it is followed by exit to program
@@ -36,179 +37,307 @@ func (l *Logger) Panicf(format string, a ...interface{}) {
 
 // Critical logs a message at a Critical Level
 func (l *Logger) Critical(message string) {
-	l.logInternal(LCrit, message, 2)
+	if l.worker.enabled(LCrit) {
+		l.logInternal(LCrit, message, 2)
+	}
 }
 
 // Criticalf logs a message at Critical level using the same syntax and options as fmt.Printf
 func (l *Logger) Criticalf(format string, a ...interface{}) {
-	l.logInternal(LCrit, fmt.Sprintf(format, a...), 2)
+	if l.worker.enabled(LCrit) {
+		l.logInternal(LCrit, fmt.Sprintf(format, a...), 2)
+	}
 }
 
 // Error logs a message at Error level
 func (l *Logger) Error(message string) {
-	l.logInternal(LErr, message, 2)
+	if l.worker.enabled(LErr) {
+		l.logInternal(LErr, message, 2)
+	}
 }
 
 // Errorf logs a message at Error level using the same syntax and options as fmt.Printf
 func (l *Logger) Errorf(format string, a ...interface{}) {
-	l.logInternal(LErr, fmt.Sprintf(format, a...), 2)
+	if l.worker.enabled(LErr) {
+		l.logInternal(LErr, fmt.Sprintf(format, a...), 2)
+	}
 }
 
 // Warning logs a message at Warning level
 func (l *Logger) Warning(message string) {
-	l.logInternal(LWarn, message, 2)
+	if l.worker.enabled(LWarn) {
+		l.logInternal(LWarn, message, 2)
+	}
 }
 
 // Warningf logs a message at Warning level using the same syntax and options as fmt.Printf
 func (l *Logger) Warningf(format string, a ...interface{}) {
-	l.logInternal(LWarn, fmt.Sprintf(format, a...), 2)
+	if l.worker.enabled(LWarn) {
+		l.logInternal(LWarn, fmt.Sprintf(format, a...), 2)
+	}
 }
 
 // Notice logs a message at Notice level
 func (l *Logger) Notice(message string) {
-	l.logInternal(LNotice, message, 2)
+	if l.worker.enabled(LNotice) {
+		l.logInternal(LNotice, message, 2)
+	}
 }
 
 // Noticef logs a message at Notice level using the same syntax and options as fmt.Printf
 func (l *Logger) Noticef(format string, a ...interface{}) {
-	l.logInternal(LNotice, fmt.Sprintf(format, a...), 2)
+	if l.worker.enabled(LNotice) {
+		l.logInternal(LNotice, fmt.Sprintf(format, a...), 2)
+	}
 }
 
 // Info logs a message at Info level
 func (l *Logger) Info(message string) {
-	l.logInternal(LInfo, message, 2)
+	if l.worker.enabled(LInfo) {
+		l.logInternal(LInfo, message, 2)
+	}
 }
 
 // Infof logs a message at Info level using the same syntax and options as fmt.Printf
 func (l *Logger) Infof(format string, a ...interface{}) {
-	l.logInternal(LInfo, fmt.Sprintf(format, a...), 2)
+	if l.worker.enabled(LInfo) {
+		l.logInternal(LInfo, fmt.Sprintf(format, a...), 2)
+	}
 }
 
 // Debug logs a message at Debug level
 func (l *Logger) Debug(message string) {
-	l.logInternal(LDebug, message, 2)
+	if l.worker.enabled(LDebug) {
+		l.logInternal(LDebug, message, 2)
+	}
 }
 
 // Debugf logs a message at Debug level using the same syntax and options as fmt.Printf
 func (l *Logger) Debugf(format string, a ...interface{}) {
-	l.logInternal(LDebug, fmt.Sprintf(format, a...), 2)
+	if l.worker.enabled(LDebug) {
+		l.logInternal(LDebug, fmt.Sprintf(format, a...), 2)
+	}
+}
+
+// LogFunc logs the string returned by fn at lvl, fn is only called if lvl is enabled
+func (l *Logger) LogFunc(lvl Lvl, fn func() string) {
+	if l.worker.enabled(lvl) {
+		l.logInternal(lvl, fn, 2)
+	}
+}
+
+// DebugFunc logs the string returned by fn at Debug level, fn is only called if Debug is enabled
+func (l *Logger) DebugFunc(fn func() string) {
+	if l.worker.enabled(LDebug) {
+		l.logInternal(LDebug, fn, 2)
+	}
 }
 
 // StackAsError Prints a goroutine's execution stack as an error with an optional message at the begining
 func (l *Logger) StackAsError(message string) {
-	l.logInternal(LErr, stack(message), 2)
+	if l.worker.enabled(LErr) {
+		l.logInternal(LErr, stack(message), 2)
+	}
 }
 
 // StackAsCritical Prints a goroutine's execution stack as critical with an optional message at the begining
 func (l *Logger) StackAsCritical(message string) {
-	l.logInternal(LCrit, stack(message), 2)
+	if l.worker.enabled(LCrit) {
+		l.logInternal(LCrit, stack(message), 2)
+	}
 }
 
-var defaultLogger *Logger = &Logger{
-	Module: "msg",
-	worker: newWorker("", activeFormat, activeTimeFormat, 0, true, os.Stdout, LDebug),
+var (
+	defaultLogger *Logger = &Logger{
+		Module: "msg",
+		worker: newWorker("", "", "", 0, ColorAuto, os.Stdout, LDebug),
+	}
+	replacedDefault atomic.Value // *Logger given to SetDefault
+)
+
+// Default returns the Logger used by the package functions
+func Default() *Logger {
+	if l, ok := replacedDefault.Load().(*Logger); ok {
+		return l
+	}
+	return defaultLogger
+}
+
+// SetDefault makes l the Logger used by the package functions, nil restores the initial one
+func SetDefault(l *Logger) {
+	if l == nil {
+		l = defaultLogger
+	}
+	replacedDefault.Store(l)
 }
 
 // Fatal is just like func l.Critical logger except that it is followed by exit to program
 func Fatal(message string) {
-	defaultLogger.logInternal(LCrit, message, 2)
+	Default().logInternal(LCrit, message, 2)
 	os.Exit(1)
 }
 
 // Fatalf is just like func l.CriticalF logger except that it is followed by exit to program
 func Fatalf(format string, a ...interface{}) {
-	defaultLogger.logInternal(LCrit, fmt.Sprintf(format, a...), 2)
+	Default().logInternal(LCrit, fmt.Sprintf(format, a...), 2)
 	os.Exit(1)
 }
 
 // Panic is just like func l.Critical except that it is followed by a call to panic
 func Panic(message string) {
-	defaultLogger.logInternal(LCrit, message, 2)
+	Default().logInternal(LCrit, message, 2)
 	panic(message)
 }
 
 // Panicf is just like func l.CriticalF except that it is followed by a call to panic
 func Panicf(format string, a ...interface{}) {
-	defaultLogger.logInternal(LCrit, fmt.Sprintf(format, a...), 2)
+	Default().logInternal(LCrit, fmt.Sprintf(format, a...), 2)
 	panic(fmt.Sprintf(format, a...))
 }
 
 // Critical logs a message at a Critical Level
 func Critical(message string) {
-	defaultLogger.logInternal(LCrit, message, 2)
+	if l := Default(); l.worker.enabled(LCrit) {
+		l.logInternal(LCrit, message, 2)
+	}
 }
 
 // Criticalf logs a message at Critical level using the same syntax and options as fmt.Printf
 func Criticalf(format string, a ...interface{}) {
-	defaultLogger.logInternal(LCrit, fmt.Sprintf(format, a...), 2)
+	if l := Default(); l.worker.enabled(LCrit) {
+		l.logInternal(LCrit, fmt.Sprintf(format, a...), 2)
+	}
 }
 
 // Error logs a message at Error level
 func Error(message string) {
-	defaultLogger.logInternal(LErr, message, 2)
+	if l := Default(); l.worker.enabled(LErr) {
+		l.logInternal(LErr, message, 2)
+	}
 }
 
 // Errorf logs a message at Error level using the same syntax and options as fmt.Printf
 func Errorf(format string, a ...interface{}) {
-	defaultLogger.logInternal(LErr, fmt.Sprintf(format, a...), 2)
+	if l := Default(); l.worker.enabled(LErr) {
+		l.logInternal(LErr, fmt.Sprintf(format, a...), 2)
+	}
 }
 
 // Warning logs a message at Warning level
 func Warning(message string) {
-	defaultLogger.logInternal(LWarn, message, 2)
+	if l := Default(); l.worker.enabled(LWarn) {
+		l.logInternal(LWarn, message, 2)
+	}
 }
 
 // Warningf logs a message at Warning level using the same syntax and options as fmt.Printf
 func Warningf(format string, a ...interface{}) {
-	defaultLogger.logInternal(LWarn, fmt.Sprintf(format, a...), 2)
+	if l := Default(); l.worker.enabled(LWarn) {
+		l.logInternal(LWarn, fmt.Sprintf(format, a...), 2)
+	}
 }
 
 // Notice logs a message at Notice level
 func Notice(message string) {
-	defaultLogger.logInternal(LNotice, message, 2)
+	if l := Default(); l.worker.enabled(LNotice) {
+		l.logInternal(LNotice, message, 2)
+	}
 }
 
 // Noticef logs a message at Notice level using the same syntax and options as fmt.Printf
 func Noticef(format string, a ...interface{}) {
-	defaultLogger.logInternal(LNotice, fmt.Sprintf(format, a...), 2)
+	if l := Default(); l.worker.enabled(LNotice) {
+		l.logInternal(LNotice, fmt.Sprintf(format, a...), 2)
+	}
 }
 
 // Info logs a message at Info level
 func Info(message string) {
-	defaultLogger.logInternal(LInfo, message, 2)
+	if l := Default(); l.worker.enabled(LInfo) {
+		l.logInternal(LInfo, message, 2)
+	}
 }
 
 // Infof logs a message at Info level using the same syntax and options as fmt.Printf
 func Infof(format string, a ...interface{}) {
-	defaultLogger.logInternal(LInfo, fmt.Sprintf(format, a...), 2)
+	if l := Default(); l.worker.enabled(LInfo) {
+		l.logInternal(LInfo, fmt.Sprintf(format, a...), 2)
+	}
 }
 
 // Debug logs a message at Debug level
 func Debug(message string) {
-	defaultLogger.logInternal(LDebug, message, 2)
+	if l := Default(); l.worker.enabled(LDebug) {
+		l.logInternal(LDebug, message, 2)
+	}
 }
 
 // Debugf logs a message at Debug level using the same syntax and options as fmt.Printf
 func Debugf(format string, a ...interface{}) {
-	defaultLogger.logInternal(LDebug, fmt.Sprintf(format, a...), 2)
+	if l := Default(); l.worker.enabled(LDebug) {
+		l.logInternal(LDebug, fmt.Sprintf(format, a...), 2)
+	}
+}
+
+// LogFunc logs the string returned by fn at lvl, fn is only called if lvl is enabled
+func LogFunc(lvl Lvl, fn func() string) {
+	if l := Default(); l.worker.enabled(lvl) {
+		l.logInternal(lvl, fn, 2)
+	}
+}
+
+// DebugFunc logs the string returned by fn at Debug level, fn is only called if Debug is enabled
+func DebugFunc(fn func() string) {
+	if l := Default(); l.worker.enabled(LDebug) {
+		l.logInternal(LDebug, fn, 2)
+	}
 }
 
 // StackAsError Prints a goroutine's execution stack as an error with an optional message at the begining
 func StackAsError(message string) {
-	defaultLogger.logInternal(LErr, stack(message), 2)
+	if l := Default(); l.worker.enabled(LErr) {
+		l.logInternal(LErr, stack(message), 2)
+	}
 }
 
 // StackAsCritical Prints a goroutine's execution stack as critical with an optional message at the begining
 func StackAsCritical(message string) {
-	defaultLogger.logInternal(LCrit, stack(message), 2)
+	if l := Default(); l.worker.enabled(LCrit) {
+		l.logInternal(LCrit, stack(message), 2)
+	}
 }
 
+// SetOutput changes the writer of the default Logger
 func SetOutput(w io.Writer) {
-	defaultLogger.SetOutput(w)
+	Default().SetOutput(w)
+}
+
+// SetFormat changes the format of the default Logger, see Logger.SetFormat
+func SetFormat(f string) error {
+	return Default().SetFormat(f)
+}
+
+// SetTimeFormat changes the time format of the default Logger
+func SetTimeFormat(timeformat string) error {
+	return Default().SetTimeFormat(timeformat)
+}
+
+// SetLogLevel changes the verbosity of the default Logger
+func SetLogLevel(level Lvl) {
+	Default().SetLogLevel(level)
+}
+
+// SetColor changes the color mode of the default Logger
+func SetColor(mode ColorMode) {
+	Default().SetColor(mode)
 }
 
-func SetFormat(f string) {
-	defaultLogger.SetFormat(f)
+// SetModule changes the module of the default Logger, replacing it with a copy
+// sharing its output, format and level so that it is safe while logging
+func SetModule(module string) {
+	l := *Default()
+	l.Module = module
+	SetDefault(&l)
 }
 
 func stack(s string) string {
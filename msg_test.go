@@ -5,10 +5,18 @@ package log
 
 import (
 	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	stdlog "log"
 	"os"
+	"runtime"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/szampardi/msg/ansi"
+	"github.com/szampardi/msg/unicode"
 )
 
 func BenchmarkLoggerLog(b *testing.B) {
@@ -34,6 +42,52 @@ func BenchmarkLoggerLog(b *testing.B) {
 	}
 }
 
+// message formats shipped in Formats, time formats excluded
+var builtinFormats = []string{CLIFormat, PlainFormat, PlainFormatWithEmoji, StdFormat, StdFormatWithEmoji, SimpleFormat, JSONFormat}
+
+func BenchmarkFormats(b *testing.B) {
+	for _, name := range builtinFormats {
+		b.Run(name, func(b *testing.B) {
+			log, err := New(Formats[name].String(), DefTimeFmt, "testing", io.Discard, false, LDebug)
+			if err != nil {
+				panic(err)
+			}
+			b.ReportAllocs()
+			b.ResetTimer()
+			for n := 0; n < b.N; n++ {
+				log.Infof("benchmark %s", "message")
+			}
+		})
+	}
+}
+
+func BenchmarkDisabledLevel(b *testing.B) {
+	log, err := New(StdFormat, DefTimeFmt, "testing", io.Discard, false, LCrit)
+	if err != nil {
+		panic(err)
+	}
+	b.ReportAllocs()
+	b.ResetTimer()
+	for n := 0; n < b.N; n++ {
+		log.Debugf("benchmark %s", "message")
+	}
+}
+
+func TestDisabledLevelAllocs(t *testing.T) {
+	log, err := New(StdFormat, DefTimeFmt, "testing", io.Discard, false, LWarn)
+	if err != nil {
+		panic(err)
+	}
+	allocs := testing.AllocsPerRun(100, func() {
+		log.Debug("disabled")
+		log.Infof("disabled %s %d", "level", 42)
+		log.Log(LNotice, "disabled")
+	})
+	if allocs != 0 {
+		t.Errorf("Unexpected allocations for disabled levels: %v", allocs)
+	}
+}
+
 func BenchmarkLoggerNew(b *testing.B) {
 	for n := 0; n <= b.N; n++ {
 		log, err := New(StdFormat, DefTimeFmt, "testing")
@@ -61,7 +115,7 @@ func TestColorString(t *testing.T) {
 }
 
 func TestNewWorker(t *testing.T) {
-	var worker *worker = newWorker("testing", activeFormat, activeTimeFormat, 0, true, os.Stderr, LDebug)
+	var worker *worker = newWorker("testing", "", "", 0, ColorAlways, os.Stderr, LDebug)
 	if worker.Minion == nil {
 		t.Errorf("Minion was not established")
 	}
@@ -69,26 +123,81 @@ func TestNewWorker(t *testing.T) {
 
 func BenchmarkNewWorker(b *testing.B) {
 	for n := 0; n <= b.N; n++ {
-		worker := newWorker("testing", activeFormat, activeTimeFormat, 0, true, os.Stderr, LDebug)
+		worker := newWorker("testing", "", "", 0, ColorAlways, os.Stderr, LDebug)
 		if worker == nil {
 			panic("Failed to initiate worker")
 		}
 	}
 }
 func TestSetFormat(t *testing.T) {
-	activeFormat = "%{module} %{lvl} %{message}"
-	var buf bytes.Buffer
-	log, err := New(StdFormat, DefTimeFmt, "pkgname", &buf)
-	log.SetFormat(activeFormat)
+	var buf, other bytes.Buffer
+	log, err := New(StdFormat, "15:04", "pkgname", &buf)
 	if err != nil {
-		panic(err)
+		t.Fatal(err)
+	}
+	unchanged, err := New(PlainFormat, DefTimeFmt, "other", &other)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := log.SetFormat("%{module} %{lvl} %{time} %{message}"); err != nil {
+		t.Fatal(err)
 	}
-	log.Infof("Test %d", 123)
-	want := "pkgname FAT Test 123\n"
-	have := buf.String()
-	if want != have {
+	log.SetClock(ClockFunc(func() time.Time { return time.Date(2021, 3, 4, 5, 6, 7, 0, time.UTC) }))
+	log.Criticalf("Test %d", 123)
+	unchanged.Critical("plain")
+	want := "pkgname FAT 05:06 Test 123\n"
+	if have := buf.String(); want != have {
 		t.Errorf("\nWant: %sHave: %s", want, have)
 	}
+	if have := other.String(); have != "plain\n" {
+		t.Errorf("SetFormat changed another Logger: %q", have)
+	}
+
+	for _, format := range []string{JSONFormat, StdFormat, "%{color}", "%[3]s: %[7]s"} {
+		if err := log.SetFormat(format); err != nil {
+			t.Errorf("%s: %s", format, err)
+		}
+	}
+	buf.Reset()
+	log.Critical("printf")
+	if have := buf.String(); have != "pkgname: printf\n" {
+		t.Errorf("Unexpected printf format output %q", have)
+	}
+	for _, format := range []string{"", "%{nope}", "jsn", "yaml", "plain text"} {
+		if err := log.SetFormat(format); err == nil {
+			t.Errorf("%q: expected an error", format)
+		}
+	}
+	if log.Format() != "%[3]s: %[7]s" {
+		t.Errorf("Invalid format applied: %q", log.Format())
+	}
+}
+
+func TestSetDefaultFormat(t *testing.T) {
+	defer defaultFormats.Store(getDefaultFormats())
+	if err := SetDefaultFormat("%{nope}"); err == nil {
+		t.Error("Expected an error for an invalid format")
+	}
+	before, err := New("", "", &bytes.Buffer{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := SetDefaultFormat(SimpleFormat); err != nil {
+		t.Fatal(err)
+	}
+	if err := SetDefaultTimeFormat(CLITimeFmt); err != nil {
+		t.Fatal(err)
+	}
+	after, err := New("", "", &bytes.Buffer{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if after.Format() != SimpleFormat || after.TimeFormat() != time.RFC822 {
+		t.Errorf("Unexpected defaults %q %q", after.Format(), after.TimeFormat())
+	}
+	if before.Format() == SimpleFormat || Default().Format() == SimpleFormat {
+		t.Errorf("SetDefaultFormat changed existing Loggers")
+	}
 }
 
 func TestLogLevel(t *testing.T) {
@@ -105,7 +214,7 @@ func TestLogLevel(t *testing.T) {
 	//}
 	for fmtname, frmt := range Formats {
 		for _, test := range tests {
-			log, _ := New(frmt.String(), activeTimeFormat, "testing", os.Stdout, LCrit)
+			log, _ := New(frmt.String(), DefTimeFmt, "testing", os.Stdout, LCrit)
 			log.SetLogLevel(test.level)
 			_fmtname := string(fmtname)
 			log.Critical("Log Critical with format " + _fmtname)
@@ -121,3 +230,551 @@ func TestLogLevel(t *testing.T) {
 		}
 	}
 }
+
+func logThroughHelper(l *Logger, message string) {
+	Helper()
+	l.Info(message)
+}
+
+func TestCaller(t *testing.T) {
+	var buf bytes.Buffer
+	log, err := New(PlainFormat, DefTimeFmt, "caller", &buf, false, LDebug)
+	if err != nil {
+		t.Fatal(err)
+	}
+	log.SetFormat("%{file}|%{func}|%{package}|%{shortpath:0}|%{message}")
+	log.Info("direct")
+	logThroughHelper(&log, "helper")
+	log.WithCallerSkip(1).Info("skipped")
+	deepHelper(&log, 20, "deep")
+	log.SetCallerLookup(false)
+	log.Info("nocaller")
+	want := "msg_test.go|TestCaller|github.com/szampardi/msg|msg_test.go|direct\n" +
+		"msg_test.go|TestCaller|github.com/szampardi/msg|msg_test.go|helper\n" +
+		"testing.go|tRunner|testing|testing.go|skipped\n" +
+		"msg_test.go|TestCaller|github.com/szampardi/msg|msg_test.go|deep\n" +
+		"||||nocaller\n"
+	if have := buf.String(); want != have {
+		t.Errorf("\nWant: %sHave: %s", want, have)
+	}
+
+	// toggled while logging
+	done := make(chan struct{})
+	go func() {
+		log.SetCallerLookup(true)
+		close(done)
+	}()
+	log.Info("racing")
+	<-done
+}
+
+// helpers calling each other, more than resolveCaller reads at once
+func deepHelper(l *Logger, depth int, message string) {
+	Helper()
+	if depth == 0 {
+		l.Info(message)
+		return
+	}
+	deepHelper(l, depth-1, message)
+}
+
+type countingValuer int
+
+func (c *countingValuer) LogValue() interface{} {
+	*c++
+	return "valued"
+}
+
+func TestLazyMessage(t *testing.T) {
+	var buf bytes.Buffer
+	log, err := New(PlainFormat, DefTimeFmt, "lazy", &buf, false, LInfo)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var calls int
+	fn := func() string {
+		calls++
+		return "called"
+	}
+	var valuer countingValuer
+	log.DebugFunc(fn)
+	log.Log(LDebug, &valuer)
+	if calls != 0 || valuer != 0 || log.Enabled(LDebug) {
+		t.Errorf("Debug messages evaluated with level %d", LInfo)
+	}
+	log.LogFunc(LInfo, fn)
+	log.Log(LNotice, &valuer)
+	if calls != 1 || valuer != 1 || !log.Enabled(LInfo) {
+		t.Errorf("Unexpected evaluations: func %d, valuer %d", calls, valuer)
+	}
+	if want, have := "called\nvalued\n", buf.String(); want != have {
+		t.Errorf("\nWant: %sHave: %s", want, have)
+	}
+}
+
+func TestFormatModifiers(t *testing.T) {
+	var buf bytes.Buffer
+	log, err := New("[%{level:-7}] [%{module:.3}] [%{lvl:5}] %{message}", DefTimeFmt, "modifiers", &buf, false, LDebug)
+	if err != nil {
+		t.Fatal(err)
+	}
+	log.Info("padded")
+	want := "[INFO   ] [mod] [  INF] padded\n"
+	if have := buf.String(); want != have {
+		t.Errorf("\nWant: %sHave: %s", want, have)
+	}
+	for _, format := range []string{"%{nonex-verb}", "%{}", "%{level:x}", "%s", "%[13]s"} {
+		if err := log.SetFormat(format); err == nil {
+			t.Errorf("Expected an error for format %q", format)
+		}
+	}
+}
+
+func TestColorDirectives(t *testing.T) {
+	var buf bytes.Buffer
+	log, err := New("%{color}%{level:-5}%{color:reset} %{emoji} %{color:bold}%{message}", DefTimeFmt, "colors", &buf, true, LDebug)
+	if err != nil {
+		t.Fatal(err)
+	}
+	log.Warning("partial")
+	reset, bold := ansi.Controls["Reset"].Str, ansi.Controls["Bold"].Str
+	want := Levels[LWarn].escaped + "WARN " + reset + " " + Levels[LWarn].emoji + " " + bold + "partial" + reset + "\n"
+	if have := buf.String(); want != have {
+		t.Errorf("\nWant: %qHave: %q", want, have)
+	}
+	buf.Reset()
+	log, _ = New("%{color}%{lvl}%{color:reset} %{message}", DefTimeFmt, "colors", &buf, false, LDebug)
+	log.Warning("no colors")
+	if want, have := "WAR no colors\n", buf.String(); want != have {
+		t.Errorf("\nWant: %qHave: %q", want, have)
+	}
+	if err := log.SetFormat("%{color:antimatter}%{message}"); err == nil {
+		t.Errorf("Expected an error for an unknown color")
+	}
+
+	// the profile is the one of the output, not of the format
+	t.Setenv("COLORTERM", "truecolor")
+	log, _ = New("%{color:#ff8800}%{message}", DefTimeFmt, "colors", &buf, ColorAuto, LDebug)
+	t.Setenv("FORCE_COLOR", "1")
+	t.Setenv("COLORTERM", "")
+	t.Setenv("TERM", "xterm-256color")
+	log.SetOutput(&buf)
+	buf.Reset()
+	log.Info("256")
+	if want, have := "\033[38;5;208m256"+reset+"\n", buf.String(); want != have {
+		t.Errorf("\nWant: %qHave: %q", want, have)
+	}
+	t.Setenv("NO_COLOR", "")
+	log.SetOutput(&buf)
+	buf.Reset()
+	log.Info("none")
+	if want, have := "none\n", buf.String(); want != have {
+		t.Errorf("\nWant: %qHave: %q", want, have)
+	}
+}
+
+func TestColorAuto(t *testing.T) {
+	for _, env := range []string{"NO_COLOR", "FORCE_COLOR", "CLICOLOR_FORCE", "CLICOLOR", "TERM"} {
+		t.Setenv(env, "")
+		os.Unsetenv(env)
+	}
+	var buf bytes.Buffer
+	log, err := New(PlainFormat, DefTimeFmt, "auto", &buf, LDebug)
+	if err != nil {
+		t.Fatal(err)
+	}
+	log.Info("pipe")
+	os.Setenv("FORCE_COLOR", "1")
+	log.SetOutput(&buf)
+	log.Info("forced")
+	os.Setenv("NO_COLOR", "")
+	log.SetOutput(&buf)
+	log.Info("no color")
+	want := "pipe\n" + Levels[LInfo].escaped + "forced" + ansi.Controls["Reset"].Str + "\nno color\n"
+	if have := buf.String(); want != have {
+		t.Errorf("\nWant: %qHave: %q", want, have)
+	}
+}
+
+func TestFormatWidePadding(t *testing.T) {
+	var buf bytes.Buffer
+	log, err := New("[%{emoji:-4}][%{message:6}]", DefTimeFmt, "wide", &buf, false, LDebug)
+	if err != nil {
+		t.Fatal(err)
+	}
+	log.Info("日本")
+	want := "[" + Levels[LInfo].emoji + "  ][  日本]\n"
+	if have := buf.String(); want != have {
+		t.Errorf("\nWant: %sHave: %s", want, have)
+	}
+}
+
+func TestEmojiTheme(t *testing.T) {
+	var buf bytes.Buffer
+	log, err := New("%{emoji} %{message}", DefTimeFmt, "emoji", &buf, false, LDebug)
+	if err != nil {
+		t.Fatal(err)
+	}
+	log.Warning("default")
+	log.SetEmojiTheme(EmojiThemes[SymbolsTheme])
+	log.Warning("symbols")
+	log.SetEmojiTheme(EmojiTheme{LWarn: "W"})
+	log.Warning("custom")
+	log.Info("missing")
+	want := Levels[LWarn].emoji + " default\n" + EmojiThemes[SymbolsTheme][LWarn] + " symbols\nW custom\n" + Levels[LInfo].emoji + " missing\n"
+	if have := buf.String(); want != have {
+		t.Errorf("\nWant: %sHave: %s", want, have)
+	}
+	if err := SetLevelEmoji(LWarn, ":antimatter:"); err == nil {
+		t.Errorf("Expected an error for an unknown emoji")
+	}
+
+	// changed while logging
+	buf.Reset()
+	log.SetEmojiTheme(nil)
+	defer setLevelEmoji(LWarn, "", false)
+	done := make(chan struct{})
+	go func() {
+		SetLevelEmoji(LWarn, ":warning:")
+		close(done)
+	}()
+	log.Warning("racing")
+	<-done
+	log.Warning("named")
+	if have := buf.String(); !strings.HasSuffix(have, "\n"+unicode.Emoji(":warning:")+" named\n") {
+		t.Errorf("Level emoji not changed: %q", have)
+	}
+}
+
+func TestRingBuffer(t *testing.T) {
+	var buf bytes.Buffer
+	log, err := New("%{level} %{message}", DefTimeFmt, "ring", &buf, false, LWarn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := NewRingBuffer(3, LDebug)
+	log.SetRingBuffer(r)
+	if !log.Enabled(LDebug) {
+		t.Errorf("Entries recorded by a RingBuffer should be enabled")
+	}
+	start := time.Now()
+	log.Debug("one")
+	log.Info("two")
+	log.Warning("three")
+	log.WithFields(Fields{"n": 4}).Info("four")
+	if have := r.Len(); have != 3 {
+		t.Errorf("Expected the last 3 entries, have %d", have)
+	}
+	if have := buf.String(); have != "WARN three\n" {
+		t.Errorf("Only entries up to LWarn should be written, have %q", have)
+	}
+	if have := r.Entries(ByLevel(LWarn)); len(have) != 1 || have[0].Message != "three" {
+		t.Errorf("Unexpected entries %+v", have)
+	}
+	if have := r.Entries(Between(start, time.Now())); len(have) != 3 || have[2].Fields["n"] != 4 {
+		t.Errorf("Unexpected entries %+v", have)
+	}
+	if have := r.Entries(ByModule("other")); len(have) != 0 {
+		t.Errorf("Unexpected entries %+v", have)
+	}
+	var dump bytes.Buffer
+	if err := r.Dump(&dump, "%{lvl} %{message} %{fields}", DefTimeFmt); err != nil {
+		t.Fatal(err)
+	}
+	if want, have := "INF two \nWAR three \nINF four n=4\n", dump.String(); want != have {
+		t.Errorf("\nWant: %q\nHave: %q", want, have)
+	}
+
+	// an error writes what was filtered out before it, once
+	buf.Reset()
+	r.FlushOn(LErr)
+	log.Debug("five")
+	log.Error("six")
+	log.Error("seven")
+	if want, have := "INFO four\nDEBUG five\nERROR six\nERROR seven\n", buf.String(); want != have {
+		t.Errorf("\nWant: %q\nHave: %q", want, have)
+	}
+	log.SetRingBuffer(nil)
+	if log.Enabled(LDebug) {
+		t.Errorf("LDebug should be disabled without a RingBuffer")
+	}
+}
+
+func TestRingBufferShared(t *testing.T) {
+	var api, db bytes.Buffer
+	la, _ := New("api %{message}", DefTimeFmt, "api", &api, LWarn)
+	lb, _ := New("db %{message}", DefTimeFmt, "db", &db, LWarn)
+	r := NewRingBuffer(10, LDebug)
+	r.FlushOn(LErr)
+	la.SetRingBuffer(r)
+	lb.SetRingBuffer(r)
+	la.Debug("a1")
+	lb.Debug("b1")
+	la.WithFields(Fields{"n": 1}).Info("a2")
+	la.Error("a3")
+	if want, have := "api a1\napi a2\napi a3\n", api.String(); want != have {
+		t.Errorf("\nWant: %q\nHave: %q", want, have)
+	}
+	if db.Len() != 0 {
+		t.Errorf("Entries of another Logger were flushed: %q", db.String())
+	}
+	lb.Error("b2")
+	if want, have := "db b1\ndb b2\n", db.String(); want != have {
+		t.Errorf("\nWant: %q\nHave: %q", want, have)
+	}
+	if r.Len() != 5 {
+		t.Errorf("Expected the entries of both Loggers, have %d", r.Len())
+	}
+}
+
+func TestStdLogger(t *testing.T) {
+	var buf bytes.Buffer
+	log, err := New("%{level} %{file}:%{line} %{message}", DefTimeFmt, &buf, false, LInfo)
+	if err != nil {
+		t.Fatal(err)
+	}
+	std := log.WithLevelDetection(true).StdLogger(LNotice)
+	std.Printf("ERROR: %s", "boom")
+	_, _, line, _ := runtime.Caller(0)
+	std.Println("[debug] hidden")
+	std.Print("plain")
+	want := fmt.Sprintf("%s msg_test.go:%d boom\n%s msg_test.go:%d plain\n", Levels[LErr].Str, line-1, Levels[LNotice].Str, line+2)
+	if have := buf.String(); want != have {
+		t.Errorf("\nWant: %sHave: %s", want, have)
+	}
+
+	buf.Reset()
+	defer func(out io.Writer, flags int, prefix string) {
+		stdlog.SetOutput(out)
+		stdlog.SetFlags(flags)
+		stdlog.SetPrefix(prefix)
+	}(stdlog.Writer(), stdlog.Flags(), stdlog.Prefix())
+	RedirectStdLog(&log, LWarn)
+	stdlog.Print("[warn]not detected")
+	_, _, line, _ = runtime.Caller(0)
+	want = fmt.Sprintf("%s msg_test.go:%d [warn]not detected\n", Levels[LWarn].Str, line-1)
+	if have := buf.String(); want != have {
+		t.Errorf("\nWant: %sHave: %s", want, have)
+	}
+}
+
+func TestWriter(t *testing.T) {
+	var buf bytes.Buffer
+	log, err := New("%{lvl} %{message}", DefTimeFmt, &buf, false, LDebug)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w := log.WithLevelDetection(true).Writer(LInfo)
+	io.WriteString(w, "first\r\nsec")
+	io.WriteString(w, "ond\nwarn: third\n")
+	long := bytes.Repeat([]byte("x"), MaxLineLength+1)
+	w.Write(long)
+	io.WriteString(w, "\nlast")
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := io.WriteString(w, "closed"); err != ErrClosed {
+		t.Errorf("Expected ErrClosed writing after Close, got %v", err)
+	}
+	want := "INF first\nINF second\nWAR third\nINF " + string(long[:MaxLineLength]) + "\nINF x\nINF last\n"
+	if have := buf.String(); want != have {
+		t.Errorf("\nWant: %.80q\nHave: %.80q", want, have)
+	}
+}
+
+func TestLoadEnv(t *testing.T) {
+	path := t.TempDir() + "/out.log"
+	env := map[string]string{
+		EnvFormat:     "%{module} %{lvl} %{time} %{message}",
+		EnvTimeFormat: "2006",
+		EnvLevel:      "warn",
+		EnvColor:      "always",
+		EnvOutput:     path,
+		EnvModule:     "envmod",
+	}
+	log, err := New(PlainFormat, DefTimeFmt, &bytes.Buffer{}, ColorNever, LDebug)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := loadEnv(&log, func(k string) string { return env[k] }); err != nil {
+		t.Fatal(err)
+	}
+	log.SetColor(ColorNever) // set by the program, wins over the environment
+	log.Info("hidden")
+	log.Warning("shown")
+	b, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want, have := "envmod WAR "+time.Now().Format("2006")+" shown\n", string(b); want != have {
+		t.Errorf("\nWant: %sHave: %s", want, have)
+	}
+
+	env = map[string]string{EnvLevel: "loud", EnvColor: "maybe", EnvFormat: "%{nope}", EnvModule: "valid"}
+	err = loadEnv(&log, func(k string) string { return env[k] })
+	if err == nil {
+		t.Fatal("Expected errors for invalid variables")
+	}
+	for _, name := range []string{EnvLevel, EnvColor, EnvFormat} {
+		if !bytes.Contains([]byte(err.Error()), []byte(name)) {
+			t.Errorf("%s is not reported in %q", name, err)
+		}
+	}
+	if log.Module != "valid" {
+		t.Errorf("Valid variables should be applied")
+	}
+
+	// the file opened for the environment is closed once the program replaces it
+	opened := log.OutputWriter().(*os.File)
+	log.SetOutput(&bytes.Buffer{})
+	if _, err := opened.Write([]byte("x")); !errors.Is(err, os.ErrClosed) {
+		t.Errorf("Output opened for %s not closed: %v", EnvOutput, err)
+	}
+}
+
+func TestSetDefault(t *testing.T) {
+	buf := &bytes.Buffer{}
+	log, err := New("%{module} %{lvl} %{message}", DefTimeFmt, buf, ColorNever, LInfo)
+	if err != nil {
+		t.Fatal(err)
+	}
+	SetDefault(&log)
+	defer SetDefault(nil)
+	if Default() != &log {
+		t.Fatal("Default is not the Logger given to SetDefault")
+	}
+	Debug("hidden")
+	Info("one")
+	SetModule("other")
+	SetLogLevel(LDebug)
+	Debug("two")
+	if want, have := "msg INF one\nother DEB two\n", buf.String(); want != have {
+		t.Errorf("\nWant: %sHave: %s", want, have)
+	}
+	if log.Module != "msg" {
+		t.Errorf("SetModule changed the Logger given to SetDefault")
+	}
+
+	if err := SetTimeFormat("15:04"); err != nil {
+		t.Fatal(err)
+	}
+	SetColor(ColorAlways)
+	l := Default()
+	if l.LogLevel() != LDebug || l.Color() != ColorAlways || l.TimeFormat() != "15:04" ||
+		l.Format() != "%{module} %{lvl} %{message}" || l.OutputWriter() != buf {
+		t.Errorf("Unexpected settings %d %d %q %q", l.LogLevel(), l.Color(), l.TimeFormat(), l.Format())
+	}
+	SetDefault(nil)
+	if Default() != defaultLogger {
+		t.Errorf("SetDefault(nil) did not restore the initial Logger")
+	}
+}
+
+func TestClock(t *testing.T) {
+	var buf bytes.Buffer
+	log, err := New("%{time} %{message}", DefTimeFmt, &buf, LDebug)
+	if err != nil {
+		t.Fatal(err)
+	}
+	at := time.Date(2021, 3, 4, 5, 6, 7, 8000000, time.UTC)
+	log.SetClock(ClockFunc(func() time.Time { return at }))
+	log.Info("utc")
+	log.SetLocation(time.FixedZone("CET", 3600))
+	log.Info("cet")
+	if err := log.SetTimeFormat(UnixMilliTimeFmt); err != nil {
+		t.Fatal(err)
+	}
+	log.Info("ms")
+	want := "2021-03-04T05:06:07Z utc\n2021-03-04T06:06:07+01:00 cet\n1614834367008 ms\n"
+	if have := buf.String(); want != have {
+		t.Errorf("\nWant: %sHave: %s", want, have)
+	}
+
+	buf.Reset()
+	if err := log.SetFormat(JSONFormat); err != nil {
+		t.Fatal(err)
+	}
+	if err := log.SetTimeFormat(UnixTimeFmt); err != nil {
+		t.Fatal(err)
+	}
+	log.Info("epoch")
+	if have := buf.String(); !strings.Contains(have, `"time":1614834367,`) {
+		t.Errorf("Unexpected JSON time %s", have)
+	}
+
+	// an entry rendered again after the location is reset is in local time
+	log.SetLocation(nil)
+	if loc := log.worker.inLocation(at.In(time.FixedZone("CET", 3600))).Location(); loc != time.Local {
+		t.Errorf("Unexpected location %v", loc)
+	}
+}
+
+func TestIDMode(t *testing.T) {
+	var a, b bytes.Buffer
+	la, _ := New("%{id} %{message}", DefTimeFmt, &a)
+	lb, _ := New("%{id} %{message}", DefTimeFmt, &b)
+	la.SetIDMode(IDCounter)
+	lb.SetIDMode(IDCounter)
+	la.Notice("one")
+	la.WithFields(Fields{"k": "v"}).Notice("two")
+	lb.Notice("first")
+	la.SetIDMode(IDNone)
+	la.Notice("none")
+	if want, have := "1 one\n2 two\n none\n", a.String(); want != have {
+		t.Errorf("\nWant: %sHave: %s", want, have)
+	}
+	if want, have := "1 first\n", b.String(); want != have {
+		t.Errorf("\nWant: %sHave: %s", want, have)
+	}
+
+	b.Reset()
+	lb.SetIDMode(IDULID)
+	lb.SetClock(ClockFunc(func() time.Time { return time.Unix(1614834367, 0) }))
+	var ids []string
+	for i := 0; i < 3; i++ {
+		lb.Notice("ulid")
+		line := strings.TrimSuffix(b.String(), " ulid\n")
+		b.Reset()
+		if len(line) != 26 || !strings.HasPrefix(line, "01EZX") {
+			t.Fatalf("Unexpected ULID %q", line)
+		}
+		if len(ids) > 0 && line <= ids[len(ids)-1] {
+			t.Errorf("ULIDs out of order: %q after %q", line, ids[len(ids)-1])
+		}
+		ids = append(ids, line)
+	}
+
+	lb.SetFormat(JSONFormat)
+	lb.Notice("json")
+	if have := b.String(); !strings.Contains(have, `"id":"01EZX`) {
+		t.Errorf("Unexpected JSON ULID %s", have)
+	}
+	b.Reset()
+	lb.SetIDMode(IDCounter)
+	lb.Notice("json")
+	if have := b.String(); !strings.Contains(have, `"id":2,`) {
+		t.Errorf("Unexpected JSON counter %s", have)
+	}
+}
+
+func TestSetDefaultLocation(t *testing.T) {
+	cet := time.FixedZone("CET", 3600)
+	before, _ := New("%{time} %{message}", "15:04", &bytes.Buffer{})
+	SetDefaultLocation(cet)
+	defer SetDefaultLocation(nil)
+	after, _ := New("%{time} %{message}", "15:04", &bytes.Buffer{})
+	if before.Location() != nil || after.Location() != cet {
+		t.Errorf("Unexpected locations %v %v", before.Location(), after.Location())
+	}
+	cfg, err := ParseConfig([]byte(`{"loggers": {"a": {}, "b": {"location": "UTC"}}}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	loggers, err := FromConfig(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if loggers["a"].Location() != cet || loggers["b"].Location() != time.UTC {
+		t.Errorf("Unexpected locations from config %v %v", loggers["a"].Location(), loggers["b"].Location())
+	}
+}
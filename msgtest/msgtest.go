@@ -0,0 +1,181 @@
+// COPYRIGHT (c) 2019-2021 SILVANO ZAMPARDI, ALL RIGHTS RESERVED.
+// The license for these sources can be found in the LICENSE file in the root directory of this source tree.
+
+// Package msgtest helps testing code that logs with msg: Loggers created by
+// NewLogger record their entries, to be checked with RequireLogged, and print
+// them with t.Log so they show up with the output of the test that logged them
+package msgtest
+
+import (
+	"bytes"
+	"strings"
+	"sync"
+	"testing"
+
+	msg "github.com/szampardi/msg"
+)
+
+// Observer records the entries of a Logger, it is a msg.EntryWriter
+type Observer struct {
+	mu      sync.Mutex
+	entries []msg.Entry
+	out     *Writer
+}
+
+// Write is only there to be an io.Writer, lines come through WriteEntry
+func (o *Observer) Write(p []byte) (int, error) {
+	return len(p), nil
+}
+
+// WriteEntry records e and passes the line p to the test log
+func (o *Observer) WriteEntry(e *msg.Entry, p []byte) (int, error) {
+	o.mu.Lock()
+	o.entries = append(o.entries, *e)
+	o.mu.Unlock()
+	if o.out != nil {
+		return o.out.Write(p)
+	}
+	return len(p), nil
+}
+
+// Entries returns the entries recorded, oldest first
+func (o *Observer) Entries() []msg.Entry {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	return append([]msg.Entry(nil), o.entries...)
+}
+
+// Count returns the number of entries recorded at lvl
+func (o *Observer) Count(lvl msg.Lvl) int {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	n := 0
+	for _, e := range o.entries {
+		if e.Level == lvl {
+			n++
+		}
+	}
+	return n
+}
+
+// Logged reports whether an entry at lvl with a message containing s was recorded
+func (o *Observer) Logged(lvl msg.Lvl, s string) bool {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	for _, e := range o.entries {
+		if e.Level == lvl && strings.Contains(e.Message, s) {
+			return true
+		}
+	}
+	return false
+}
+
+// Reset forgets the entries recorded
+func (o *Observer) Reset() {
+	o.mu.Lock()
+	o.entries = nil
+	o.mu.Unlock()
+}
+
+var (
+	mu        sync.Mutex
+	observers = map[testing.TB][]*Observer{}
+)
+
+// NewLogger returns a Logger recording all levels for the assertions of this package,
+// its entries are printed with t.Log. args are the ones of msg.New, the module is the
+// name of the test by default. The Logger stops printing when the test ends
+func NewLogger(t testing.TB, args ...interface{}) (*msg.Logger, *Observer) {
+	t.Helper()
+	o := &Observer{out: NewWriter(t)}
+	args = append([]interface{}{t.Name(), msg.LDebug, msg.ColorNever}, args...)
+	args = append(args, o)
+	l, err := msg.New("%{lvl} %{shortpath:1}:%{line} %{message} %{fields}", msg.DefTimeFmt, args...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	mu.Lock()
+	observers[t] = append(observers[t], o)
+	mu.Unlock()
+	t.Cleanup(func() {
+		mu.Lock()
+		delete(observers, t)
+		mu.Unlock()
+	})
+	return &l, o
+}
+
+// RequireLogged stops the test unless a Logger made by NewLogger for t
+// recorded an entry at lvl with a message containing s
+func RequireLogged(t testing.TB, lvl msg.Lvl, s string) {
+	t.Helper()
+	mu.Lock()
+	obs := observers[t]
+	mu.Unlock()
+	var seen []string
+	for _, o := range obs {
+		if o.Logged(lvl, s) {
+			return
+		}
+		for _, e := range o.Entries() {
+			seen = append(seen, "\n\t"+msg.Levels[e.Level].Str+" "+e.Message)
+		}
+	}
+	t.Fatalf("no %s entry containing %q was logged, entries:%s", msg.Levels[lvl].Str, s, strings.Join(seen, ""))
+}
+
+// RequireNotLogged stops the test if a Logger made by NewLogger for t
+// recorded an entry at lvl with a message containing s
+func RequireNotLogged(t testing.TB, lvl msg.Lvl, s string) {
+	t.Helper()
+	mu.Lock()
+	obs := observers[t]
+	mu.Unlock()
+	for _, o := range obs {
+		if o.Logged(lvl, s) {
+			t.Fatalf("unexpected %s entry containing %q", msg.Levels[lvl].Str, s)
+		}
+	}
+}
+
+// Count returns the number of entries at lvl recorded by the Loggers made by NewLogger for t
+func Count(t testing.TB, lvl msg.Lvl) int {
+	mu.Lock()
+	obs := observers[t]
+	mu.Unlock()
+	n := 0
+	for _, o := range obs {
+		n += o.Count(lvl)
+	}
+	return n
+}
+
+// Writer prints lines with t.Log, set it as the output of a Logger to see its
+// entries with the output of the test. Writes after the end of the test are dropped
+type Writer struct {
+	mu   sync.Mutex
+	t    testing.TB
+	done bool
+}
+
+// NewWriter returns a Writer printing with t.Log until the test ends
+func NewWriter(t testing.TB) *Writer {
+	w := &Writer{t: t}
+	t.Cleanup(func() {
+		w.mu.Lock()
+		w.done = true
+		w.mu.Unlock()
+	})
+	return w
+}
+
+// Write prints p with t.Log, without trailing spaces and newline
+func (w *Writer) Write(p []byte) (int, error) {
+	w.t.Helper()
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if !w.done {
+		w.t.Log(string(bytes.TrimRight(p, " \n")))
+	}
+	return len(p), nil
+}
@@ -0,0 +1,82 @@
+// COPYRIGHT (c) 2019-2021 SILVANO ZAMPARDI, ALL RIGHTS RESERVED.
+// The license for these sources can be found in the LICENSE file in the root directory of this source tree.
+
+package msgtest
+
+import (
+	"strings"
+	"testing"
+
+	msg "github.com/szampardi/msg"
+)
+
+func TestObserver(t *testing.T) {
+	log, o := NewLogger(t)
+	log.WithFields(msg.Fields{"user": "bob"}).Error("login failed")
+	log.Info("retrying")
+	log.Info("done")
+
+	RequireLogged(t, msg.LErr, "failed")
+	RequireNotLogged(t, msg.LErr, "done")
+	if have := Count(t, msg.LInfo); have != 2 {
+		t.Errorf("Expected 2 info entries, have %d", have)
+	}
+	entries := o.Entries()
+	if len(entries) != 3 {
+		t.Fatalf("Expected 3 entries, have %d", len(entries))
+	}
+	e := entries[0]
+	if e.Module != t.Name() || e.Fields["user"] != "bob" || e.File != "msgtest_test.go" || e.Func != "TestObserver" {
+		t.Errorf("Unexpected entry %+v", e)
+	}
+	o.Reset()
+	if have := o.Count(msg.LInfo); have != 0 {
+		t.Errorf("Expected no entries after Reset, have %d", have)
+	}
+}
+
+// fakeTB records what the helpers report instead of failing the test
+type fakeTB struct {
+	testing.TB
+	fatal   string
+	logs    []string
+	helpers int
+}
+
+func (f *fakeTB) Helper() {
+	f.helpers++
+}
+
+func (f *fakeTB) Fatalf(format string, args ...interface{}) {
+	f.fatal = format
+}
+
+func (f *fakeTB) Log(args ...interface{}) {
+	f.logs = append(f.logs, args[0].(string))
+}
+
+func TestRequireLoggedFails(t *testing.T) {
+	log, _ := NewLogger(t)
+	log.Warning("something")
+	tb := &fakeTB{TB: t}
+	RequireLogged(tb, msg.LErr, "something")
+	if tb.fatal == "" {
+		t.Errorf("RequireLogged should fail without an observer for the test")
+	}
+}
+
+func TestWriter(t *testing.T) {
+	tb := &fakeTB{TB: t}
+	w := NewWriter(tb)
+	log, err := msg.New(msg.PlainFormat, msg.DefTimeFmt, w, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	log.Notice("hello")
+	if len(tb.logs) != 1 || strings.TrimSpace(tb.logs[0]) != "hello" {
+		t.Errorf("Unexpected logs %q", tb.logs)
+	}
+	if tb.helpers == 0 {
+		t.Errorf("Write is not marked as a helper")
+	}
+}
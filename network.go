@@ -0,0 +1,356 @@
+// COPYRIGHT (c) 2019-2021 SILVANO ZAMPARDI, ALL RIGHTS RESERVED.
+// The license for these sources can be found in the LICENSE file in the root directory of this source tree.
+
+package log
+
+import (
+	"crypto/tls"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// NetFraming is how entries are delimited on stream connections
+type NetFraming int
+
+// Network framings
+const (
+	NewlineFraming NetFraming = iota // one entry per line
+	LengthPrefixed                   // 4 bytes big endian length before each entry
+)
+
+// defaults of NetConfig
+const (
+	DefaultNetBuffer  = 1024
+	DefaultNetTimeout = 10 * time.Second
+)
+
+// NetConfig configures a NetWriter, only Network and Address are needed
+type NetConfig struct {
+	Network    string      // "tcp", "udp", "unix", "unixgram" or "tls"
+	Address    string      // host:port or socket path
+	TLS        *tls.Config // for "tls", the system roots and the host of Address by default
+	Framing    NetFraming
+	Timeout    time.Duration // of connections and writes, DefaultNetTimeout by default
+	RetryMin   time.Duration // first delay before reconnecting, DefaultRetryMin by default
+	RetryMax   time.Duration // longest delay before reconnecting, DefaultRetryMax by default
+	BufferSize int           // entries kept in memory while disconnected, DefaultNetBuffer by default
+	SpoolFile  string        // where entries not fitting the buffer go, they are dropped without one
+	SpoolMax   int64         // size limit of the spool file in bytes, none by default
+}
+
+// NetStats are the counters of a NetWriter
+type NetStats struct {
+	Sent        uint64 // entries written to the connection
+	Dropped     uint64 // entries lost because buffer and spool were full
+	Queued      int    // entries waiting to be sent, in memory and in the spool
+	SpoolErrors uint64 // failed saves of the spool offset, the entries sent since the last one are sent again after a restart
+}
+
+// NetWriter ships entries to a server over the network, set it as the output of a Logger.
+// Writes never block on the network: entries are queued and sent in the background,
+// reconnecting with a jittered exponential backoff after errors. While disconnected,
+// the latest BufferSize entries are kept in memory and older ones are moved to the
+// spool file, if any, or dropped. Spooled entries survive restarts and are sent first
+type NetWriter struct {
+	cfg         NetConfig
+	stream      bool
+	mu          sync.Mutex
+	ring        ring
+	spool       *spool
+	wake        chan struct{}
+	closing     chan struct{}
+	done        chan struct{}
+	sent        uint64
+	dropped     uint64
+	spoolErrors uint64
+	pending     []byte // taken from the queue, being sent
+	spooled     bool   // pending is the oldest entry of the spool, still in it
+	closed      bool
+}
+
+// ErrClosed is returned by outputs after Close
+var ErrClosed = errors.New("output closed")
+
+// NewNetWriter starts a NetWriter, the connection is established in the background
+func NewNetWriter(cfg NetConfig) (*NetWriter, error) {
+	w := &NetWriter{
+		cfg:     cfg,
+		wake:    make(chan struct{}, 1),
+		closing: make(chan struct{}),
+		done:    make(chan struct{}),
+	}
+	var ok bool
+	if w.stream, ok = netStream(cfg.Network); !ok {
+		return nil, fmt.Errorf("unsupported network %q", cfg.Network)
+	}
+	if w.cfg.Timeout <= 0 {
+		w.cfg.Timeout = DefaultNetTimeout
+	}
+	if w.cfg.BufferSize <= 0 {
+		w.cfg.BufferSize = DefaultNetBuffer
+	}
+	w.ring.items = make([][]byte, w.cfg.BufferSize)
+	if cfg.SpoolFile != "" {
+		var err error
+		if w.spool, err = openSpool(cfg.SpoolFile, cfg.SpoolMax); err != nil {
+			return nil, err
+		}
+	}
+	go w.run()
+	w.signal()
+	return w, nil
+}
+
+// whether network is connection oriented, ok is false when a NetWriter does not support it
+func netStream(network string) (stream, ok bool) {
+	switch network {
+	case "tcp", "tcp4", "tcp6", "unix", "tls":
+		return true, true
+	case "udp", "udp4", "udp6", "unixgram":
+		return false, true
+	}
+	return false, false
+}
+
+// Write queues p, it fails only after Close
+func (w *NetWriter) Write(p []byte) (int, error) {
+	entry := make([]byte, len(p))
+	copy(entry, p)
+	for len(entry) > 0 && entry[len(entry)-1] == '\n' {
+		entry = entry[:len(entry)-1]
+	}
+	w.mu.Lock()
+	if w.closed {
+		w.mu.Unlock()
+		return 0, ErrClosed
+	}
+	if oldest := w.ring.push(entry); oldest != nil {
+		w.overflow(oldest)
+	}
+	w.mu.Unlock()
+	w.signal()
+	return len(p), nil
+}
+
+// move an entry out of memory, to the spool if it fits
+func (w *NetWriter) overflow(entry []byte) {
+	if w.spool == nil || w.spool.append(entry) != nil {
+		atomic.AddUint64(&w.dropped, 1)
+	}
+}
+
+func (w *NetWriter) signal() {
+	select {
+	case w.wake <- struct{}{}:
+	default:
+	}
+}
+
+// Stats returns the counters of w
+func (w *NetWriter) Stats() NetStats {
+	w.mu.Lock()
+	queued := w.ring.n
+	if w.spool != nil {
+		queued += w.spool.count
+	}
+	if w.pending != nil {
+		queued++
+	}
+	w.mu.Unlock()
+	return NetStats{
+		Sent:        atomic.LoadUint64(&w.sent),
+		Dropped:     atomic.LoadUint64(&w.dropped),
+		Queued:      queued,
+		SpoolErrors: atomic.LoadUint64(&w.spoolErrors),
+	}
+}
+
+// Close sends what it can without reconnecting and stops w, entries left are
+// saved to the spool or dropped
+func (w *NetWriter) Close() error {
+	w.mu.Lock()
+	if w.closed {
+		w.mu.Unlock()
+		return nil
+	}
+	w.closed = true
+	w.mu.Unlock()
+	close(w.closing)
+	<-w.done
+	if w.spool != nil {
+		return w.spool.f.Close()
+	}
+	return nil
+}
+
+// the oldest queued entry, spooled entries come first
+func (w *NetWriter) next() []byte {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.pending != nil {
+		return w.pending
+	}
+	if w.spool != nil && w.spool.count > 0 {
+		entry, err := w.spool.peek()
+		if err != nil {
+			// unreadable, give up on the rest of it
+			atomic.AddUint64(&w.dropped, uint64(w.spool.count))
+			if w.spool.reset() != nil {
+				atomic.AddUint64(&w.spoolErrors, 1)
+			}
+		}
+		w.pending, w.spooled = entry, entry != nil
+	}
+	if w.pending == nil {
+		w.pending = w.ring.pop()
+	}
+	return w.pending
+}
+
+// the sender
+func (w *NetWriter) run() {
+	defer close(w.done)
+	var (
+		conn  net.Conn
+		retry = newBackoff(w.cfg.RetryMin, w.cfg.RetryMax)
+		buf   []byte
+		timer = time.NewTimer(0)
+	)
+	defer func() {
+		if conn != nil {
+			conn.Close()
+		}
+	}()
+	for {
+		select {
+		case <-w.wake:
+		case <-timer.C:
+		case <-w.closing:
+			w.drain(conn)
+			return
+		}
+		for entry := w.next(); entry != nil; entry = w.next() {
+			if conn == nil {
+				now := time.Now()
+				if !retry.ready(now) {
+					timer.Reset(retry.wait(now))
+					break
+				}
+				var err error
+				if conn, err = w.dial(); err != nil {
+					retry.fail(now)
+					timer.Reset(retry.wait(now))
+					break
+				}
+			}
+			buf = w.frame(buf[:0], entry)
+			conn.SetWriteDeadline(time.Now().Add(w.cfg.Timeout))
+			if _, err := conn.Write(buf); err != nil {
+				conn.Close()
+				conn = nil
+				retry.fail(time.Now())
+				timer.Reset(retry.wait(time.Now()))
+				break
+			}
+			retry.reset()
+			w.sentPending()
+		}
+	}
+}
+
+// the pending entry was sent, a spooled one can leave the spool
+func (w *NetWriter) sentPending() {
+	w.mu.Lock()
+	// the entry is out of the spool in memory even if its offset is not saved,
+	// the next advance saves it again
+	if w.spooled && w.spool.advance(len(w.pending)) != nil {
+		atomic.AddUint64(&w.spoolErrors, 1)
+	}
+	w.pending, w.spooled = nil, false
+	w.mu.Unlock()
+	atomic.AddUint64(&w.sent, 1)
+}
+
+// on Close, send the queue while the connection works and save the rest
+func (w *NetWriter) drain(conn net.Conn) {
+	var buf []byte
+	for entry := w.next(); entry != nil; entry = w.next() {
+		if conn != nil {
+			buf = w.frame(buf[:0], entry)
+			conn.SetWriteDeadline(time.Now().Add(w.cfg.Timeout))
+			if _, err := conn.Write(buf); err == nil {
+				w.sentPending()
+				continue
+			}
+			conn = nil
+		}
+		w.mu.Lock()
+		if !w.spooled { // else it is still first in the spool
+			w.overflow(entry)
+		}
+		for e := w.ring.pop(); e != nil; e = w.ring.pop() {
+			w.overflow(e)
+		}
+		w.pending, w.spooled = nil, false
+		w.mu.Unlock()
+		return
+	}
+}
+
+func (w *NetWriter) dial() (net.Conn, error) {
+	d := &net.Dialer{Timeout: w.cfg.Timeout}
+	if w.cfg.Network == "tls" {
+		return tls.DialWithDialer(d, "tcp", w.cfg.Address, w.cfg.TLS)
+	}
+	return d.Dial(w.cfg.Network, w.cfg.Address)
+}
+
+func (w *NetWriter) frame(dst, entry []byte) []byte {
+	if !w.stream {
+		return append(dst, entry...)
+	}
+	if w.cfg.Framing == LengthPrefixed {
+		var n [4]byte
+		binary.BigEndian.PutUint32(n[:], uint32(len(entry)))
+		dst = append(dst, n[:]...)
+		return append(dst, entry...)
+	}
+	dst = append(dst, entry...)
+	return append(dst, '\n')
+}
+
+// ring is a fixed size queue dropping its oldest items when full
+type ring struct {
+	items   [][]byte
+	head, n int
+}
+
+// push p, returning the item it replaced if full
+func (r *ring) push(p []byte) (oldest []byte) {
+	i := (r.head + r.n) % len(r.items)
+	if r.n == len(r.items) {
+		oldest = r.items[i]
+		r.head = (r.head + 1) % len(r.items)
+	} else {
+		r.n++
+	}
+	r.items[i] = p
+	return oldest
+}
+
+// pop the oldest item, nil when empty
+func (r *ring) pop() []byte {
+	if r.n == 0 {
+		return nil
+	}
+	p := r.items[r.head]
+	r.items[r.head] = nil
+	r.head = (r.head + 1) % len(r.items)
+	r.n--
+	return p
+}
@@ -0,0 +1,244 @@
+// COPYRIGHT (c) 2019-2021 SILVANO ZAMPARDI, ALL RIGHTS RESERVED.
+// The license for these sources can be found in the LICENSE file in the root directory of this source tree.
+
+package log
+
+import (
+	"bufio"
+	"encoding/binary"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestNetWriterFraming(t *testing.T) {
+	socket := filepath.Join(t.TempDir(), "collector.sock")
+	ln, err := net.Listen("unix", socket)
+	if err != nil {
+		t.Skip(err)
+	}
+	defer ln.Close()
+	w, err := NewNetWriter(NetConfig{Network: "unix", Address: socket, Framing: LengthPrefixed})
+	if err != nil {
+		t.Fatal(err)
+	}
+	log, err := New(PlainFormat, DefTimeFmt, "net", w, false, LDebug)
+	if err != nil {
+		t.Fatal(err)
+	}
+	log.Info("first")
+	log.Info("multi\nline")
+	c, err := ln.Accept()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	c.SetReadDeadline(time.Now().Add(5 * time.Second))
+	for _, want := range []string{"first", "multi\nline"} {
+		var n [4]byte
+		if _, err := io.ReadFull(c, n[:]); err != nil {
+			t.Fatal(err)
+		}
+		b := make([]byte, binary.BigEndian.Uint32(n[:]))
+		if _, err := io.ReadFull(c, b); err != nil {
+			t.Fatal(err)
+		}
+		if have := string(b); have != want {
+			t.Errorf("\nWant: %q\nHave: %q", want, have)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if stats := w.Stats(); stats.Sent != 2 || stats.Dropped != 0 || stats.Queued != 0 {
+		t.Errorf("Unexpected stats %+v", stats)
+	}
+	if _, err := w.Write([]byte("late")); err != ErrClosed {
+		t.Errorf("Expected ErrClosed writing after Close, got %v", err)
+	}
+}
+
+func TestNetWriterOutage(t *testing.T) {
+	// find a free port, nothing listens there for now
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Skip(err)
+	}
+	addr := ln.Addr().String()
+	ln.Close()
+
+	spooled, err := NewNetWriter(NetConfig{Network: "tcp", Address: addr, BufferSize: 2, SpoolFile: filepath.Join(t.TempDir(), "spool"), RetryMin: 5 * time.Millisecond, RetryMax: 20 * time.Millisecond})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer spooled.Close()
+	dropping, err := NewNetWriter(NetConfig{Network: "unix", Address: filepath.Join(t.TempDir(), "none.sock"), BufferSize: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer dropping.Close()
+	for i := 0; i < 5; i++ {
+		spooled.Write([]byte(strconv.Itoa(i) + "\n"))
+		dropping.Write([]byte(strconv.Itoa(i) + "\n"))
+	}
+	if stats := dropping.Stats(); stats.Dropped != 3 || stats.Queued != 2 {
+		t.Errorf("Unexpected stats without spool %+v", stats)
+	}
+	if stats := spooled.Stats(); stats.Dropped != 0 || stats.Queued != 5 {
+		t.Errorf("Unexpected stats with spool %+v", stats)
+	}
+
+	// the collector comes back, everything is sent in order
+	if ln, err = net.Listen("tcp", addr); err != nil {
+		t.Skip(err)
+	}
+	defer ln.Close()
+	c, err := ln.Accept()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	c.SetReadDeadline(time.Now().Add(5 * time.Second))
+	r := bufio.NewReader(c)
+	for i := 0; i < 5; i++ {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want := strconv.Itoa(i) + "\n"; line != want {
+			t.Errorf("\nWant: %q\nHave: %q", want, line)
+		}
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for spooled.Stats().Sent != 5 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	if stats := spooled.Stats(); stats.Sent != 5 || stats.Queued != 0 {
+		t.Errorf("Unexpected stats after reconnecting %+v", stats)
+	}
+}
+
+func TestSpoolResume(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "spool")
+	s, err := openSpool(path, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 4; i++ {
+		s.append([]byte(strconv.Itoa(i)))
+	}
+	for i := 0; i < 2; i++ { // sent before a restart
+		p, _ := s.peek()
+		s.advance(len(p))
+	}
+	s.f.Close()
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Skip(err)
+	}
+	defer ln.Close()
+	w, err := NewNetWriter(NetConfig{Network: "tcp", Address: ln.Addr().String(), SpoolFile: path})
+	if err != nil {
+		t.Fatal(err)
+	}
+	c, err := ln.Accept()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	w.Write([]byte("4\n"))
+	w.Close()
+	c.SetReadDeadline(time.Now().Add(5 * time.Second))
+	b, _ := io.ReadAll(c)
+	if want, have := "2\n3\n4\n", string(b); want != have {
+		t.Errorf("\nWant: %q\nHave: %q", want, have)
+	}
+
+	// the first entry of the spool is pending when closing without a connection
+	s, err = openSpool(path, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 3; i++ {
+		s.append([]byte(strconv.Itoa(i)))
+	}
+	s.f.Close()
+	w, err = NewNetWriter(NetConfig{Network: "unix", Address: filepath.Join(t.TempDir(), "none.sock"), BufferSize: 2, SpoolFile: path})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 3; i < 6; i++ {
+		w.Write([]byte(strconv.Itoa(i) + "\n"))
+	}
+	time.Sleep(10 * time.Millisecond) // let the sender take the first entry
+	w.Close()
+	if s, err = openSpool(path, 0); err != nil {
+		t.Fatal(err)
+	}
+	defer s.f.Close()
+	var have []string
+	for p, _ := s.peek(); p != nil; p, _ = s.peek() {
+		have = append(have, string(p))
+		s.advance(len(p))
+	}
+	if want := "0 1 2 3 4 5"; strings.Join(have, " ") != want {
+		t.Errorf("\nWant: %s\nHave: %s", want, strings.Join(have, " "))
+	}
+}
+
+func TestSpoolCompact(t *testing.T) {
+	s, err := openSpool(filepath.Join(t.TempDir(), "spool"), spoolHeader+3*5)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.f.Close()
+	for i := 0; i < 3; i++ {
+		if err := s.append([]byte{'a' + byte(i)}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := s.append([]byte("d")); err != errSpoolFull {
+		t.Errorf("Expected errSpoolFull, got %v", err)
+	}
+	p, _ := s.peek()
+	s.advance(len(p))
+	if err := s.append([]byte("d")); err != nil {
+		t.Fatalf("Sent entries were not compacted: %v", err)
+	}
+	var have []byte
+	for p, _ := s.peek(); p != nil; p, _ = s.peek() {
+		have = append(have, p...)
+		s.advance(len(p))
+	}
+	if string(have) != "bcd" {
+		t.Errorf("Unexpected entries after compaction %q", have)
+	}
+}
+
+func TestSpoolOffsetNotSaved(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "spool")
+	s, err := openSpool(path, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.append([]byte("a"))
+	s.append([]byte("b"))
+	s.f.Close()
+	if s.f, err = os.Open(path); err != nil { // read only, the offset cannot be saved
+		t.Fatal(err)
+	}
+	defer s.f.Close()
+	p, _ := s.peek()
+	if err := s.advance(len(p)); err == nil {
+		t.Error("Saving the offset in a read only spool did not fail")
+	}
+	if p, _ = s.peek(); string(p) != "b" {
+		t.Errorf("The sent entry is still the next one: %q", p)
+	}
+}
@@ -0,0 +1,241 @@
+// COPYRIGHT (c) 2019-2021 SILVANO ZAMPARDI, ALL RIGHTS RESERVED.
+// The license for these sources can be found in the LICENSE file in the root directory of this source tree.
+
+package log
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// DefaultWatchInterval is how often a Watcher checks its file for changes
+const DefaultWatchInterval = 2 * time.Second
+
+// Watcher keeps Loggers configured by a JSON Config file, reloading it on SIGHUP or when
+// the file changes. The Logger named "default" in the file configures the default Logger.
+// A reload applies to the Loggers already handed out: either the whole new file is valid
+// and applied, or nothing changes. The format, color, time zone and output of a Logger
+// change at once, each entry is written with the old ones or the new ones; levels apply
+// to the entries logged afterwards. Outputs are only reopened when their configuration
+// changed, retired ones are closed if the Watcher opened them. Removing "default" from the
+// file gives the default Logger back the settings it had before. Modules are not reloaded
+type Watcher struct {
+	path     string
+	mu       sync.Mutex
+	current  *Config
+	loggers  map[string]*Logger
+	opened   map[string]io.Writer // by Logger name, the outputs the Watcher may close
+	original *loggerSettings      // of the default Logger, before the file configured it
+	mtime    time.Time
+	sig      chan os.Signal
+	stop     chan struct{}
+	done     chan struct{}
+	stopOnce sync.Once
+}
+
+// WatchConfig loads the Config at path and watches it, checking for changes
+// every interval (DefaultWatchInterval when 0)
+func WatchConfig(path string, interval time.Duration) (*Watcher, error) {
+	if interval <= 0 {
+		interval = DefaultWatchInterval
+	}
+	w := &Watcher{
+		path:    path,
+		current: &Config{},
+		loggers: map[string]*Logger{},
+		opened:  map[string]io.Writer{},
+		sig:     make(chan os.Signal, 1),
+		stop:    make(chan struct{}),
+		done:    make(chan struct{}),
+	}
+	if _, err := w.reload(); err != nil {
+		return nil, err
+	}
+	signal.Notify(w.sig, syscall.SIGHUP)
+	go w.run(interval)
+	return w, nil
+}
+
+// Logger returns the Logger with name, nil if the file never described it
+func (w *Watcher) Logger(name string) *Logger {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.loggers[name]
+}
+
+// Reload applies the file now, changes are logged as a Notice by the default Logger
+func (w *Watcher) Reload() error {
+	changes, err := w.reload()
+	if err != nil {
+		return err
+	}
+	if len(changes) > 0 {
+		Default().Noticef("reloaded logging config %s: %s", w.path, strings.Join(changes, ", "))
+	}
+	return nil
+}
+
+// Close stops watching, the Loggers keep their configuration and outputs
+func (w *Watcher) Close() error {
+	w.stopOnce.Do(func() {
+		signal.Stop(w.sig)
+		close(w.stop)
+	})
+	<-w.done
+	return nil
+}
+
+func (w *Watcher) run(interval time.Duration) {
+	defer close(w.done)
+	t := time.NewTicker(interval)
+	defer t.Stop()
+	for {
+		select {
+		case <-w.stop:
+			return
+		case <-w.sig:
+		case <-t.C:
+			fi, err := os.Stat(w.path)
+			w.mu.Lock()
+			unchanged := err != nil || fi.ModTime().Equal(w.mtime)
+			w.mu.Unlock()
+			if unchanged {
+				continue
+			}
+		}
+		if err := w.Reload(); err != nil {
+			Default().Errorf("reloading logging config %s: %s", w.path, err)
+		}
+	}
+}
+
+// load and apply the file, returning what changed
+func (w *Watcher) reload() ([]string, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	fi, err := os.Stat(w.path)
+	if err != nil {
+		return nil, err
+	}
+	// remembered even if invalid, not to report the same error at every check
+	w.mtime = fi.ModTime()
+	cfg, err := LoadConfig(w.path)
+	if err != nil {
+		return nil, err
+	}
+	names := make([]string, 0, len(cfg.Loggers))
+	for name := range cfg.Loggers {
+		names = append(names, name)
+	}
+	for name := range w.current.Loggers {
+		if _, ok := cfg.Loggers[name]; !ok {
+			names = append(names, name) // removed, back to the defaults
+		}
+	}
+	sort.Strings(names)
+
+	// prepare everything before changing anything
+	type update struct {
+		name     string
+		settings *loggerSettings
+		changes  []string
+		opened   bool // settings.out was opened for the update
+	}
+	var updates []update
+	for _, name := range names {
+		old, existed := w.current.Loggers[name]
+		c, kept := cfg.Loggers[name]
+		_, live := w.loggers[name]
+		newOutput := !live || !reflect.DeepEqual(old.Outputs, c.Outputs) || !reflect.DeepEqual(old.Hooks, c.Hooks)
+		changes := describeChanges(old, c, existed, kept, newOutput)
+		if len(changes) == 0 && live {
+			continue
+		}
+		if name == "default" && !kept && w.original != nil {
+			updates = append(updates, update{name, w.original, []string{"removed, back to its settings before the file"}, false})
+			continue
+		}
+		s, err := c.settings("loggers."+name, newOutput)
+		if err != nil {
+			for _, u := range updates {
+				if u.opened {
+					closeOutput(u.settings.out)
+				}
+			}
+			return nil, err
+		}
+		updates = append(updates, update{name, s, changes, s.out != nil})
+	}
+
+	var retired []io.Writer
+	var changes []string
+	for _, u := range updates {
+		l, live := w.loggers[u.name]
+		if !live {
+			if u.name == "default" {
+				l = Default()
+				w.original = l.worker.current()
+			} else {
+				l = &Logger{Module: u.name, worker: u.settings.newWorker()}
+				if c := cfg.Loggers[u.name]; c.Module != "" {
+					l.Module = c.Module
+				}
+			}
+			w.loggers[u.name] = l
+		}
+		if live || u.name == "default" {
+			// outputs of the program are left to it
+			if old := l.worker.apply(u.settings); old != nil && old == w.opened[u.name] {
+				retired = append(retired, old)
+			}
+		}
+		switch {
+		case u.opened:
+			w.opened[u.name] = u.settings.out
+		case u.settings.out != nil:
+			delete(w.opened, u.name)
+		}
+		for _, c := range u.changes {
+			changes = append(changes, u.name+" "+c)
+		}
+	}
+	w.current = cfg
+	for _, out := range retired {
+		closeOutput(out)
+	}
+	return changes, nil
+}
+
+// describe what differs between two configurations of a Logger
+func describeChanges(old, c LoggerConfig, existed, kept, newOutput bool) []string {
+	switch {
+	case !existed:
+		return []string{"added"}
+	case !kept:
+		return []string{"removed, back to defaults"}
+	}
+	var changes []string
+	for _, f := range []struct{ key, old, new string }{
+		{"level", old.Level, c.Level},
+		{"format", old.Format, c.Format},
+		{"time_format", old.TimeFormat, c.TimeFormat},
+		{"location", old.Location, c.Location},
+		{"color", old.Color, c.Color},
+	} {
+		if f.old != f.new {
+			changes = append(changes, fmt.Sprintf("%s %q -> %q", f.key, f.old, f.new))
+		}
+	}
+	if newOutput {
+		changes = append(changes, "outputs")
+	}
+	return changes
+}
@@ -0,0 +1,190 @@
+// COPYRIGHT (c) 2019-2021 SILVANO ZAMPARDI, ALL RIGHTS RESERVED.
+// The license for these sources can be found in the LICENSE file in the root directory of this source tree.
+
+package log
+
+import (
+	"io"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/szampardi/msg/ansi"
+)
+
+// RingBuffer keeps the latest entries of the Loggers using it, including the ones
+// filtered out by their level, to be inspected or dumped after something went wrong.
+// One RingBuffer can be shared by several Loggers, each one flushes its own entries
+type RingBuffer struct {
+	level Lvl
+	flush int32 // Lvl triggering a flush, -1 for none, accessed atomically
+	mu    sync.Mutex
+	slots []ringSlot
+	head  int
+	n     int
+}
+
+type ringSlot struct {
+	entry Entry
+	shown bool    // written to the output of its Logger
+	owner *worker // of the Logger that logged it, and its copies
+}
+
+// NewRingBuffer returns a RingBuffer of the latest size entries up to level
+func NewRingBuffer(size int, level Lvl) *RingBuffer {
+	if size <= 0 {
+		size = 1
+	}
+	return &RingBuffer{level: level, flush: -1, slots: make([]ringSlot, size)}
+}
+
+// SetRingBuffer makes the Logger record its entries in r, nil stops recording.
+// Entries up to the level of r are then built even if the Logger does not output them
+func (l *Logger) SetRingBuffer(r *RingBuffer) {
+	l.worker.ring.Store(r)
+	l.worker.updateLevel()
+}
+
+// FlushOn makes Loggers write the entries of r they filtered out, oldest first, to their
+// output when they log an entry at lvl or more severe (like LErr): the context of an error
+// is only shown when there is one. The entries are written once
+func (r *RingBuffer) FlushOn(lvl Lvl) {
+	atomic.StoreInt32(&r.flush, int32(lvl))
+}
+
+func (r *RingBuffer) add(e Entry, shown bool, owner *worker) {
+	r.mu.Lock()
+	i := (r.head + r.n) % len(r.slots)
+	if r.n == len(r.slots) {
+		r.head = (r.head + 1) % len(r.slots)
+	} else {
+		r.n++
+	}
+	r.slots[i] = ringSlot{entry: e, shown: shown, owner: owner}
+	r.mu.Unlock()
+}
+
+func (r *RingBuffer) triggered(lvl Lvl) bool {
+	return lvl <= Lvl(atomic.LoadInt32(&r.flush))
+}
+
+// the entries of owner not written yet, marking them as written
+func (r *RingBuffer) unshown(owner *worker) []Entry {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var entries []Entry
+	for i := 0; i < r.n; i++ {
+		s := &r.slots[(r.head+i)%len(r.slots)]
+		if !s.shown && s.owner == owner {
+			entries = append(entries, s.entry)
+			s.shown = true
+		}
+	}
+	return entries
+}
+
+// Len is the number of entries in r
+func (r *RingBuffer) Len() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.n
+}
+
+// Reset removes all entries
+func (r *RingBuffer) Reset() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for i := range r.slots {
+		r.slots[i] = ringSlot{}
+	}
+	r.head, r.n = 0, 0
+}
+
+// EntryFilter selects entries of a RingBuffer
+type EntryFilter func(e *Entry) bool
+
+// ByLevel selects entries at lvl or more severe
+func ByLevel(lvl Lvl) EntryFilter {
+	return func(e *Entry) bool { return e.Level <= lvl }
+}
+
+// ByModule selects entries of a module
+func ByModule(module string) EntryFilter {
+	return func(e *Entry) bool { return e.Module == module }
+}
+
+// Between selects entries logged from since to until, a zero time is no bound
+func Between(since, until time.Time) EntryFilter {
+	return func(e *Entry) bool {
+		return (since.IsZero() || !e.Time.Before(since)) && (until.IsZero() || !e.Time.After(until))
+	}
+}
+
+// Entries returns the entries matching all filters, oldest first
+func (r *RingBuffer) Entries(filters ...EntryFilter) []Entry {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var entries []Entry
+next:
+	for i := 0; i < r.n; i++ {
+		e := &r.slots[(r.head+i)%len(r.slots)].entry
+		for _, f := range filters {
+			if !f(e) {
+				continue next
+			}
+		}
+		entries = append(entries, *e)
+	}
+	return entries
+}
+
+// Dump writes the entries matching all filters to w, oldest first, with a format
+// and a time format like the ones of New. Caller placeholders are only filled for
+// entries logged with a format using them
+func (r *RingBuffer) Dump(w io.Writer, format, timeformat string, filters ...EntryFilter) error {
+	f, err := newFormatter(format, timeformat)
+	if err != nil {
+		return err
+	}
+	var buf buffer
+	for _, e := range r.Entries(filters...) {
+		info := entryInfo(&e)
+		info.output(&buf, f, ansi.NoColor)
+		if len(buf) == 0 || buf[len(buf)-1] != '\n' {
+			buf = append(buf, '\n')
+		}
+		if _, err := w.Write(buf); err != nil {
+			return err
+		}
+		buf = buf[:0]
+	}
+	return nil
+}
+
+// rebuild what the formats need from an entry
+func entryInfo(e *Entry) *info {
+	r := &info{
+		Module:   e.Module,
+		Level:    e.Level,
+		Line:     e.Line,
+		Filename: e.File,
+		Func:     e.Func,
+		Package:  e.Package,
+		Path:     e.Path,
+		Message:  e.Message,
+		Fields:   e.Fields,
+		Emoji:    levelEmoji(e.Level),
+		when:     e.Time,
+	}
+	r.idLen = uint8(copy(r.id[:], e.ID))
+	return r
+}
+
+// write the entries r holds that were filtered out by w
+func (w *worker) flushRing(r *RingBuffer, f *formatter, settings uint32) {
+	for _, e := range r.unshown(w) {
+		info := entryInfo(&e)
+		info.Emoji = w.emoji(e.Level)
+		w.log(e.Level, 2, f, info, settings)
+	}
+}
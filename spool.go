@@ -0,0 +1,147 @@
+// COPYRIGHT (c) 2019-2021 SILVANO ZAMPARDI, ALL RIGHTS RESERVED.
+// The license for these sources can be found in the LICENSE file in the root directory of this source tree.
+
+package log
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+)
+
+var errSpoolFull = errors.New("spool full")
+
+// the spool starts with the offset of its oldest entry, as 8 bytes big endian
+const spoolHeader = 8
+
+// spool is a queue of entries in a file, each one prefixed by its length as
+// 4 bytes big endian. Entries are read from off and appended at size. off is saved
+// in the header once an entry is sent, so sent entries are not sent again after a
+// restart (but for the last one if the process dies in between). The file is
+// truncated once everything was read, and compacted when full of sent entries
+type spool struct {
+	f         *os.File
+	max       int64
+	off, size int64
+	count     int
+}
+
+// open the spool at path, entries left by a previous run are kept
+func openSpool(path string, max int64) (*spool, error) {
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0600)
+	if err != nil {
+		return nil, err
+	}
+	fi, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	s := &spool{f: f, max: max, off: spoolHeader, size: spoolHeader}
+	var h [spoolHeader]byte
+	if _, err := f.ReadAt(h[:], 0); err == nil {
+		if off := int64(binary.BigEndian.Uint64(h[:])); off >= spoolHeader && off <= fi.Size() {
+			s.off, s.size = off, off
+		}
+	}
+	var n [4]byte
+	for {
+		if _, err = f.ReadAt(n[:], s.size); err != nil {
+			break
+		}
+		next := s.size + 4 + int64(binary.BigEndian.Uint32(n[:]))
+		if next > fi.Size() {
+			break
+		}
+		s.size = next
+		s.count++
+	}
+	// drop a partial entry at the end, if any
+	if err = f.Truncate(s.size); err == nil {
+		err = s.saveOffset()
+	}
+	if err != nil {
+		f.Close()
+		return nil, fmt.Errorf("invalid spool %s: %s", path, err)
+	}
+	return s, nil
+}
+
+func (s *spool) saveOffset() error {
+	var h [spoolHeader]byte
+	binary.BigEndian.PutUint64(h[:], uint64(s.off))
+	_, err := s.f.WriteAt(h[:], 0)
+	return err
+}
+
+func (s *spool) append(p []byte) error {
+	need := 4 + int64(len(p))
+	if s.max > 0 && s.size+need > s.max {
+		if s.size-s.off+spoolHeader+need > s.max {
+			return errSpoolFull
+		}
+		if err := s.compact(); err != nil {
+			return err
+		}
+	}
+	b := make([]byte, need)
+	binary.BigEndian.PutUint32(b, uint32(len(p)))
+	copy(b[4:], p)
+	if _, err := s.f.WriteAt(b, s.size); err != nil {
+		return err
+	}
+	s.size += need
+	s.count++
+	return nil
+}
+
+// move the entries not sent yet to the start of the file
+func (s *spool) compact() error {
+	live := make([]byte, s.size-s.off)
+	if _, err := s.f.ReadAt(live, s.off); err != nil && err != io.EOF {
+		return err
+	}
+	if _, err := s.f.WriteAt(live, spoolHeader); err != nil {
+		return err
+	}
+	s.off, s.size = spoolHeader, spoolHeader+int64(len(live))
+	if err := s.saveOffset(); err != nil {
+		return err
+	}
+	return s.f.Truncate(s.size)
+}
+
+// the oldest entry, nil when empty. It stays in the spool until advance
+func (s *spool) peek() ([]byte, error) {
+	if s.count == 0 {
+		return nil, nil
+	}
+	var n [4]byte
+	if _, err := s.f.ReadAt(n[:], s.off); err != nil {
+		return nil, err
+	}
+	p := make([]byte, binary.BigEndian.Uint32(n[:]))
+	if _, err := s.f.ReadAt(p, s.off+4); err != nil && err != io.EOF {
+		return nil, err
+	}
+	return p, nil
+}
+
+// remove the oldest entry, of length n, once sent
+func (s *spool) advance(n int) error {
+	s.off += 4 + int64(n)
+	if s.count--; s.count == 0 {
+		return s.reset()
+	}
+	return s.saveOffset()
+}
+
+func (s *spool) reset() error {
+	s.off, s.size, s.count = spoolHeader, spoolHeader, 0
+	if err := s.f.Truncate(s.size); err != nil {
+		return err
+	}
+	return s.saveOffset()
+}
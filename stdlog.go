@@ -0,0 +1,108 @@
+// COPYRIGHT (c) 2019-2021 SILVANO ZAMPARDI, ALL RIGHTS RESERVED.
+// The license for these sources can be found in the LICENSE file in the root directory of this source tree.
+
+package log
+
+import (
+	"log"
+	"runtime"
+	"strings"
+)
+
+// StdLogger returns a standard library Logger writing to l at lvl, for libraries
+// wanting one (like net/http.Server.ErrorLog). Entries are attributed to the code
+// calling the standard Logger
+func (l *Logger) StdLogger(lvl Lvl) *log.Logger {
+	return log.New(&stdWriter{l: l, lvl: lvl}, "", 0)
+}
+
+// RedirectStdLog sends the output of the standard log package to l at lvl,
+// its prefix and flags are cleared since l adds its own
+func RedirectStdLog(l *Logger, lvl Lvl) {
+	log.SetFlags(0)
+	log.SetPrefix("")
+	log.SetOutput(&stdWriter{l: l, lvl: lvl})
+}
+
+// WithLevelDetection returns a copy of the Logger that, when enabled, takes the level
+// of lines written through StdLogger, RedirectStdLog and Writer from their leading token:
+// "ERROR: message" and "[warn] message" are logged as LErr and LWarn without the
+// token. The copy shares output, format and level with l
+func (l *Logger) WithLevelDetection(enabled bool) *Logger {
+	c := *l
+	c.detectLevel = enabled
+	return &c
+}
+
+type stdWriter struct {
+	l   *Logger
+	lvl Lvl
+}
+
+func (w *stdWriter) Write(p []byte) (int, error) {
+	message := strings.TrimRight(string(p), "\r\n")
+	lvl := w.lvl
+	if w.l.detectLevel {
+		lvl, message = detectLevel(message, lvl)
+	}
+	if w.l.worker.enabled(lvl) {
+		// logInternal, Write, the frames of package log, the caller
+		w.l.logInternal(lvl, message, 2+stdlogDepth())
+	}
+	return len(p), nil
+}
+
+// number of frames of package log calling Write
+func stdlogDepth() int {
+	var pcs [8]uintptr
+	n := runtime.Callers(3, pcs[:])
+	frames := runtime.CallersFrames(pcs[:n])
+	depth := 0
+	for {
+		frame, more := frames.Next()
+		if !strings.HasPrefix(frame.Function, "log.") {
+			return depth
+		}
+		depth++
+		if !more {
+			return depth
+		}
+	}
+}
+
+// leading tokens recognized by detectLevel, in lower case
+var levelTokens = map[string]Lvl{
+	"crit":     LCrit,
+	"critical": LCrit,
+	"fatal":    LCrit,
+	"panic":    LCrit,
+	"err":      LErr,
+	"error":    LErr,
+	"warn":     LWarn,
+	"warning":  LWarn,
+	"notice":   LNotice,
+	"info":     LInfo,
+	"debug":    LDebug,
+}
+
+// take the level from a leading "LEVEL:" or "[level]" token of s, def when there is none
+func detectLevel(s string, def Lvl) (Lvl, string) {
+	var token, rest string
+	if strings.HasPrefix(s, "[") {
+		i := strings.IndexByte(s, ']')
+		if i == -1 {
+			return def, s
+		}
+		token, rest = s[1:i], s[i+1:]
+	} else {
+		i := strings.IndexByte(s, ':')
+		if i == -1 {
+			return def, s
+		}
+		token, rest = s[:i], s[i+1:]
+	}
+	if lvl, ok := levelTokens[strings.ToLower(strings.TrimSpace(token))]; ok {
+		return lvl, strings.TrimLeft(rest, " \t")
+	}
+	return def, s
+}
@@ -0,0 +1,324 @@
+// COPYRIGHT (c) 2019-2021 SILVANO ZAMPARDI, ALL RIGHTS RESERVED.
+// The license for these sources can be found in the LICENSE file in the root directory of this source tree.
+
+package log
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// SyslogFormat is the syslog protocol version
+type SyslogFormat int
+
+// Syslog formats
+const (
+	RFC5424 SyslogFormat = iota // with structured data from fields
+	RFC3164                     // BSD syslog, what most local daemons expect
+)
+
+// Facility is the syslog facility of messages
+type Facility int
+
+// Syslog facilities
+const (
+	FacilityKern Facility = iota
+	FacilityUser
+	FacilityMail
+	FacilityDaemon
+	FacilityAuth
+	FacilitySyslog
+	FacilityLPR
+	FacilityNews
+	FacilityUUCP
+	FacilityCron
+	FacilityAuthPriv
+	FacilityFTP
+	FacilityLocal0 Facility = iota + 4
+	FacilityLocal1
+	FacilityLocal2
+	FacilityLocal3
+	FacilityLocal4
+	FacilityLocal5
+	FacilityLocal6
+	FacilityLocal7
+)
+
+// Framing is how messages are delimited on stream connections (tcp, unix)
+type Framing int
+
+// Framings, from RFC 6587
+const (
+	OctetCounting  Framing = iota // "LEN MSG", safe for messages with newlines
+	NonTransparent                // "MSG\n"
+)
+
+// DefaultSDID is the structured data ID fields are sent with in RFC5424, 32473
+// is the private enterprise number reserved for documentation
+const DefaultSDID = "fields@32473"
+
+// SyslogConfig configures a SyslogWriter, only Network and Address are needed
+type SyslogConfig struct {
+	Network  string // "udp", "tcp", "unix" or "unixgram", empty for the local syslog daemon
+	Address  string // host:port or socket path
+	Format   SyslogFormat
+	Facility Facility // the zero value is FacilityKern like in log/syslog, applications want FacilityUser or a local one
+	AppName  string   // defaults to the Module of each entry
+	Hostname string   // defaults to os.Hostname
+	SDID     string   // defaults to DefaultSDID
+	Framing  Framing
+	Timeout  time.Duration // of connections and writes, none by default
+	RetryMin time.Duration // first delay before reconnecting, DefaultRetryMin by default
+	RetryMax time.Duration // longest delay before reconnecting, DefaultRetryMax by default
+}
+
+// SyslogSeverity maps a level to a syslog severity, levels
+// below LDebug (custom ones) are debug messages as well
+func SyslogSeverity(lvl Lvl) int {
+	switch {
+	case lvl <= LCrit:
+		return 2 // crit
+	case lvl >= LDebug:
+		return 7 // debug
+	}
+	return int(lvl) + 2 // err 3, warning 4, notice 5, info 6
+}
+
+// ErrDisconnected is returned by network outputs while waiting to reconnect, entries are dropped
+var ErrDisconnected = errors.New("disconnected, waiting to reconnect")
+
+// SyslogWriter sends entries to a syslog server, set it as the output of a Logger.
+// Writes fail with ErrDisconnected while the server is unreachable, reconnections
+// are attempted with an exponential backoff
+type SyslogWriter struct {
+	cfg      SyslogConfig
+	hostname string
+	pid      string
+	mu       sync.Mutex
+	conn     net.Conn
+	stream   bool
+	retry    backoff
+	buf      []byte
+}
+
+// local syslog sockets, in the order they are tried
+var syslogSockets = []string{"/dev/log", "/var/run/syslog", "/var/run/log"}
+
+// NewSyslogWriter connects to the syslog server of cfg
+func NewSyslogWriter(cfg SyslogConfig) (*SyslogWriter, error) {
+	if cfg.Facility < FacilityKern || cfg.Facility > FacilityLocal7 {
+		return nil, fmt.Errorf("invalid syslog facility %d", cfg.Facility)
+	}
+	if cfg.SDID == "" {
+		cfg.SDID = DefaultSDID
+	}
+	s := &SyslogWriter{
+		cfg:      cfg,
+		hostname: cfg.Hostname,
+		pid:      strconv.Itoa(os.Getpid()),
+		retry:    newBackoff(cfg.RetryMin, cfg.RetryMax),
+	}
+	if s.hostname == "" {
+		s.hostname, _ = os.Hostname()
+	}
+	if err := s.connect(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+func (s *SyslogWriter) connect() (err error) {
+	if s.cfg.Network != "" {
+		s.conn, err = net.DialTimeout(s.cfg.Network, s.cfg.Address, s.cfg.Timeout)
+		if err == nil {
+			s.stream = !strings.HasPrefix(s.cfg.Network, "udp") && s.cfg.Network != "unixgram"
+		}
+		return err
+	}
+	for _, path := range syslogSockets {
+		for _, network := range []string{"unixgram", "unix"} {
+			if s.conn, err = net.DialTimeout(network, path, s.cfg.Timeout); err == nil {
+				s.stream = network == "unix"
+				return nil
+			}
+		}
+	}
+	return fmt.Errorf("no local syslog daemon found: %s", err)
+}
+
+// Write sends p as a notice, for use outside of a Logger
+func (s *SyslogWriter) Write(p []byte) (int, error) {
+	return s.WriteEntry(&Entry{Time: time.Now(), Level: LNotice, Module: "msg"}, p)
+}
+
+// WriteEntry sends the line p with the level, module and fields of e
+func (s *SyslogWriter) WriteEntry(e *Entry, p []byte) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.buf = s.frame(s.buf[:0], e, p)
+	now := time.Now()
+	if s.conn == nil {
+		if !s.retry.ready(now) {
+			return 0, ErrDisconnected
+		}
+		if err := s.connect(); err != nil {
+			s.retry.fail(now)
+			return 0, err
+		}
+	}
+	if err := s.send(); err != nil {
+		// the server may have just restarted, try once more right away
+		s.conn.Close()
+		if err = s.connect(); err == nil {
+			err = s.send()
+		}
+		if err != nil {
+			if s.conn != nil {
+				s.conn.Close()
+			}
+			s.conn = nil
+			s.retry.fail(now)
+			return 0, err
+		}
+	}
+	s.retry.reset()
+	return len(p), nil
+}
+
+func (s *SyslogWriter) send() error {
+	if s.cfg.Timeout > 0 {
+		s.conn.SetWriteDeadline(time.Now().Add(s.cfg.Timeout))
+	}
+	_, err := s.conn.Write(s.buf)
+	return err
+}
+
+// Close closes the connection to the server
+func (s *SyslogWriter) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.conn == nil {
+		return nil
+	}
+	err := s.conn.Close()
+	s.conn = nil
+	return err
+}
+
+// append the framed message to dst
+func (s *SyslogWriter) frame(dst []byte, e *Entry, p []byte) []byte {
+	msg := p
+	for len(msg) > 0 && (msg[len(msg)-1] == '\n' || msg[len(msg)-1] == '\r') {
+		msg = msg[:len(msg)-1]
+	}
+	start := len(dst)
+	dst = s.message(dst, e, msg)
+	if !s.stream {
+		return dst
+	}
+	if s.cfg.Framing == NonTransparent {
+		return append(dst, '\n')
+	}
+	// octet counting, the length goes before the message
+	length := strconv.Itoa(len(dst) - start)
+	dst = append(dst, make([]byte, len(length)+1)...)
+	copy(dst[start+len(length)+1:], dst[start:len(dst)-len(length)-1])
+	copy(dst[start:], length)
+	dst[start+len(length)] = ' '
+	return dst
+}
+
+func (s *SyslogWriter) message(dst []byte, e *Entry, msg []byte) []byte {
+	app := s.cfg.AppName
+	if app == "" {
+		app = e.Module
+	}
+	dst = append(dst, '<')
+	dst = strconv.AppendInt(dst, int64(s.cfg.Facility)*8+int64(SyslogSeverity(e.Level)), 10)
+	dst = append(dst, '>')
+	if s.cfg.Format == RFC3164 {
+		dst = e.Time.AppendFormat(dst, time.Stamp)
+		dst = append(dst, ' ')
+		dst = appendHeader(dst, s.hostname, 255)
+		dst = append(dst, ' ')
+		dst = appendHeader(dst, app, 32)
+		dst = append(dst, '[')
+		dst = append(dst, s.pid...)
+		dst = append(dst, "]: "...)
+		return append(dst, msg...)
+	}
+	dst = append(dst, "1 "...)
+	dst = e.Time.AppendFormat(dst, "2006-01-02T15:04:05.000000Z07:00")
+	dst = append(dst, ' ')
+	dst = appendHeader(dst, s.hostname, 255)
+	dst = append(dst, ' ')
+	dst = appendHeader(dst, app, 48)
+	dst = append(dst, ' ')
+	dst = append(dst, s.pid...)
+	dst = append(dst, " - "...) // no MSGID
+	dst = s.structuredData(dst, e.Fields)
+	if len(msg) > 0 {
+		dst = append(dst, ' ')
+		dst = append(dst, msg...)
+	}
+	return dst
+}
+
+// header fields are printable ASCII without spaces, "-" when empty
+func appendHeader(dst []byte, s string, max int) []byte {
+	n := 0
+	for i := 0; i < len(s) && n < max; i++ {
+		if c := s[i]; c > ' ' && c < 0x7f {
+			dst = append(dst, c)
+			n++
+		}
+	}
+	if n == 0 {
+		dst = append(dst, '-')
+	}
+	return dst
+}
+
+func (s *SyslogWriter) structuredData(dst []byte, fields Fields) []byte {
+	if len(fields) == 0 {
+		return append(dst, '-')
+	}
+	keys := make([]string, 0, len(fields))
+	for k := range fields {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	dst = append(dst, '[')
+	dst = append(dst, s.cfg.SDID...)
+	for _, k := range keys {
+		dst = append(dst, ' ')
+		// names exclude '=', ' ', ']' and '"'
+		n := 0
+		for i := 0; i < len(k) && n < 32; i++ {
+			if c := k[i]; c > ' ' && c < 0x7f && c != '=' && c != ']' && c != '"' {
+				dst = append(dst, c)
+				n++
+			}
+		}
+		if n == 0 {
+			dst = append(dst, '_')
+		}
+		dst = append(dst, '=', '"')
+		// values escape '"', '\' and ']'
+		for _, c := range []byte(fmt.Sprint(fields[k])) {
+			if c == '"' || c == '\\' || c == ']' {
+				dst = append(dst, '\\')
+			}
+			dst = append(dst, c)
+		}
+		dst = append(dst, '"')
+	}
+	return append(dst, ']')
+}
@@ -0,0 +1,117 @@
+// COPYRIGHT (c) 2019-2021 SILVANO ZAMPARDI, ALL RIGHTS RESERVED.
+// The license for these sources can be found in the LICENSE file in the root directory of this source tree.
+
+package log
+
+import (
+	"bufio"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSyslogUDP(t *testing.T) {
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Skip(err)
+	}
+	defer pc.Close()
+	w, err := NewSyslogWriter(SyslogConfig{Network: "udp", Address: pc.LocalAddr().String(), Facility: FacilityLocal0, Hostname: "host"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Close()
+	log, err := New(PlainFormat, DefTimeFmt, "app", w, false, LDebug)
+	if err != nil {
+		t.Fatal(err)
+	}
+	log.WithFields(Fields{"user": `b"o]b`, "n": 1}).Error("failed")
+	pc.SetReadDeadline(time.Now().Add(5 * time.Second))
+	b := make([]byte, 2048)
+	n, _, err := pc.ReadFrom(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	have := string(b[:n])
+	// local0 * 8 + err
+	if !strings.HasPrefix(have, "<131>1 ") {
+		t.Errorf("Wrong header: %s", have)
+	}
+	want := " host app " + strconv.Itoa(os.Getpid()) + ` - [fields@32473 n="1" user="b\"o\]b"] failed`
+	if !strings.HasSuffix(have, want) {
+		t.Errorf("\nWant: %s\nHave: %s", want, have)
+	}
+}
+
+func TestSyslogTCP(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Skip(err)
+	}
+	defer ln.Close()
+	conns := make(chan net.Conn)
+	go func() {
+		for {
+			c, err := ln.Accept()
+			if err != nil {
+				close(conns)
+				return
+			}
+			conns <- c
+		}
+	}()
+	w, err := NewSyslogWriter(SyslogConfig{Network: "tcp", Address: ln.Addr().String(), Format: RFC3164, Facility: FacilityUser, Hostname: "host", RetryMin: time.Millisecond})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Close()
+	log, err := New(PlainFormat, DefTimeFmt, "app", w, false, LDebug)
+	if err != nil {
+		t.Fatal(err)
+	}
+	readFrame := func(c net.Conn) string {
+		c.SetReadDeadline(time.Now().Add(5 * time.Second))
+		r := bufio.NewReader(c)
+		length, err := r.ReadString(' ')
+		if err != nil {
+			t.Fatal(err)
+		}
+		n, err := strconv.Atoi(strings.TrimSpace(length))
+		if err != nil {
+			t.Fatalf("Not octet counted: %q", length)
+		}
+		b := make([]byte, n)
+		if _, err = r.Read(b); err != nil {
+			t.Fatal(err)
+		}
+		return string(b)
+	}
+	c := <-conns
+	log.Warning("multi\nline")
+	have := readFrame(c)
+	// user * 8 + warning
+	want := " host app[" + strconv.Itoa(os.Getpid()) + "]: multi\nline"
+	if !strings.HasPrefix(have, "<12>") || !strings.HasSuffix(have, want) {
+		t.Errorf("\nWant: <12>...%s\nHave: %s", want, have)
+	}
+
+	// the server goes away, entries are dropped until the writer reconnects
+	c.Close()
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		log.Notice("again")
+		select {
+		case c = <-conns:
+			if have := readFrame(c); !strings.HasSuffix(have, "]: again") {
+				t.Errorf("Unexpected message after reconnecting: %s", have)
+			}
+			c.Close()
+			return
+		case <-time.After(10 * time.Millisecond):
+		}
+	}
+	t.Fatal("The writer did not reconnect")
+}
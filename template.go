@@ -0,0 +1,435 @@
+// COPYRIGHT (c) 2019-2021 SILVANO ZAMPARDI, ALL RIGHTS RESERVED.
+// The license for these sources can be found in the LICENSE file in the root directory of this source tree.
+
+package log
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/szampardi/msg/ansi"
+)
+
+// field is the piece of information a template segment renders
+type field int
+
+// fields are numbered like the printf arguments of the original formats (%[1]d is the id...)
+const (
+	fieldLiteral field = iota
+	fieldID
+	fieldTime
+	fieldModule
+	fieldFile
+	fieldLine
+	fieldLevel
+	fieldMessage
+	fieldEmoji
+	fieldFunc
+	fieldPackage
+	fieldPath
+	fieldShortPath
+	fieldCount
+	fieldColor // not printf arguments
+	fieldFields
+)
+
+var (
+	// fmtPlaceholders maps %{placeholders} to their field, and to the truncation they imply
+	fmtPlaceholders = map[string]struct {
+		field field
+		prec  int
+	}{
+		"id":        {fieldID, -1},
+		"time":      {fieldTime, -1},
+		"module":    {fieldModule, -1},
+		"filename":  {fieldFile, -1},
+		"file":      {fieldFile, -1},
+		"line":      {fieldLine, -1},
+		"level":     {fieldLevel, -1},
+		"lvl":       {fieldLevel, 3},
+		"message":   {fieldMessage, -1},
+		"emoji":     {fieldEmoji, -1},
+		"color":     {fieldColor, -1},
+		"fields":    {fieldFields, -1},
+		"func":      {fieldFunc, -1},
+		"package":   {fieldPackage, -1},
+		"path":      {fieldPath, -1},
+		"shortpath": {fieldShortPath, -1},
+	}
+)
+
+// DefaultShortPathDepth is how many directories %{shortpath} keeps when no depth is given
+const DefaultShortPathDepth = 2
+
+// segment is either literal text or a field with its modifiers
+type segment struct {
+	field field
+	text  string   // literal text or time layout of fieldTime
+	esc   []string // escapes of fieldColor by ansi.Profile, chosen for the output when writing
+	depth int      // directories kept by fieldShortPath
+	width int      // minimum width in runes, negative pads on the right
+	prec  int      // maximum length in runes, -1 does not truncate
+}
+
+// template is a format compiled once into segments appended in sequence to a buffer
+type template struct {
+	segments    []segment
+	timeFormat  string // layout of the first %{time:layout}, if any
+	needsCaller bool
+	colored     bool // colors are placed by %{color} rather than wrapping the whole line
+}
+
+// compileFormat parses both %{placeholder[:arg]} templates and the positional printf
+// verbs (%[7]s, %.5[6]s...) used by the built-in Formats.
+// Arguments of %{time} are a time layout, those of %{shortpath} a depth optionally followed
+// by ":modifiers", for every other placeholder they are modifiers: [-]width[.precision],
+// "%{level:-7}" pads levels on the right to 7 characters, "%{module:.10}" truncates modules to 10.
+func compileFormat(format string) (*template, error) {
+	t := &template{}
+	var lit strings.Builder
+	flush := func() {
+		if lit.Len() > 0 {
+			t.segments = append(t.segments, segment{field: fieldLiteral, text: lit.String(), prec: -1})
+			lit.Reset()
+		}
+	}
+	for i := 0; i < len(format); {
+		idx := strings.IndexByte(format[i:], '%')
+		if idx == -1 {
+			lit.WriteString(format[i:])
+			break
+		}
+		lit.WriteString(format[i : i+idx])
+		i += idx
+		if i+1 == len(format) {
+			lit.WriteByte('%')
+			break
+		}
+		switch format[i+1] {
+		case '%':
+			lit.WriteByte('%')
+			i += 2
+			continue
+		case '{':
+			end := strings.IndexByte(format[i:], '}')
+			// invalid placeholders ("...%{inv %{verb}...") are kept as plain text
+			if next := strings.Index(format[i+1:], "%{"); end == -1 || (next != -1 && next+1 < end) {
+				lit.WriteString("%{")
+				i += 2
+				continue
+			}
+			seg, err := placeholder(format[i+2 : i+end])
+			if err != nil {
+				return nil, fmt.Errorf("invalid format at offset %d: %s", i, err)
+			}
+			flush()
+			t.add(seg)
+			i += end + 1
+		default:
+			seg, n, err := printfVerb(format[i+1:])
+			if err != nil {
+				return nil, fmt.Errorf("invalid format at offset %d: %s", i, err)
+			}
+			if n == 0 { // a lone %
+				lit.WriteByte('%')
+				i++
+				continue
+			}
+			flush()
+			t.add(seg)
+			i += n + 1
+		}
+	}
+	flush()
+	return t, nil
+}
+
+// literal reports whether the template has no placeholder nor directive
+func (t *template) literal() bool {
+	for _, seg := range t.segments {
+		if seg.field != fieldLiteral {
+			return false
+		}
+	}
+	return true
+}
+
+func (t *template) add(seg segment) {
+	switch seg.field {
+	case fieldTime:
+		if t.timeFormat == "" {
+			t.timeFormat = seg.text
+		}
+	case fieldFile, fieldLine, fieldFunc, fieldPackage, fieldPath, fieldShortPath:
+		t.needsCaller = true
+	case fieldColor:
+		t.colored = true
+	}
+	t.segments = append(t.segments, seg)
+}
+
+// parse the content of %{...}
+func placeholder(ph string) (seg segment, err error) {
+	name, arg := ph, ""
+	if idx := strings.IndexByte(ph, ':'); idx != -1 {
+		name, arg = ph[:idx], ph[idx+1:]
+	}
+	p, ok := fmtPlaceholders[name]
+	if !ok {
+		return seg, fmt.Errorf("unknown placeholder %%{%s}", name)
+	}
+	seg = segment{field: p.field, prec: p.prec}
+	switch p.field {
+	case fieldTime:
+		seg.text = timeLayout(arg)
+		return seg, nil
+	case fieldColor:
+		if arg != "" {
+			if seg.esc = colorEscapes(arg); seg.esc == nil {
+				return seg, fmt.Errorf("unknown color %q", arg)
+			}
+		}
+		return seg, nil
+	case fieldShortPath:
+		seg.depth = DefaultShortPathDepth
+		if arg != "" {
+			d := arg
+			if idx := strings.IndexByte(arg, ':'); idx != -1 {
+				d, arg = arg[:idx], arg[idx+1:]
+			} else {
+				arg = ""
+			}
+			if seg.depth, err = strconv.Atoi(d); err != nil || seg.depth < 0 {
+				return seg, fmt.Errorf("invalid depth %q for %%{%s}", d, name)
+			}
+		}
+	}
+	if arg != "" {
+		if err = seg.modifiers(arg); err != nil {
+			return seg, fmt.Errorf("invalid modifiers %q for %%{%s}", arg, name)
+		}
+	}
+	return seg, nil
+}
+
+// parse [-]width[.precision]
+func (seg *segment) modifiers(arg string) (err error) {
+	width, prec := arg, ""
+	if idx := strings.IndexByte(arg, '.'); idx != -1 {
+		width, prec = arg[:idx], arg[idx+1:]
+		if seg.prec, err = strconv.Atoi(prec); err != nil || seg.prec < 0 {
+			return fmt.Errorf("invalid precision %q", prec)
+		}
+	}
+	if width != "" {
+		if seg.width, err = strconv.Atoi(width); err != nil {
+			return fmt.Errorf("invalid width %q", width)
+		}
+	}
+	return nil
+}
+
+// parse a positional printf verb (the leading % excluded) such as "-10[3]s" or ".5[6]s",
+// returning how many bytes were consumed. Text that does not look like a verb consumes nothing
+func printfVerb(s string) (seg segment, n int, err error) {
+	seg.prec = -1
+	left := false
+	if n < len(s) && s[n] == '-' {
+		left = true
+		n++
+	}
+	start := n
+	for n < len(s) && s[n] >= '0' && s[n] <= '9' {
+		n++
+	}
+	if n > start {
+		seg.width, _ = strconv.Atoi(s[start:n])
+		if left {
+			seg.width = -seg.width
+		}
+	}
+	if n < len(s) && s[n] == '.' {
+		n++
+		start = n
+		for n < len(s) && s[n] >= '0' && s[n] <= '9' {
+			n++
+		}
+		seg.prec, _ = strconv.Atoi(s[start:n])
+	}
+	if n < len(s) && s[n] == '[' {
+		end := strings.IndexByte(s[n:], ']')
+		if end == -1 {
+			return seg, 0, nil
+		}
+		arg, aerr := strconv.Atoi(s[n+1 : n+end])
+		if aerr != nil || arg < int(fieldID) || arg >= int(fieldCount) {
+			return seg, 0, fmt.Errorf("invalid argument index %q", s[n:n+end+1])
+		}
+		seg.field = field(arg)
+		n += end + 1
+	}
+	if n == len(s) || !strings.ContainsRune("sdv", rune(s[n])) {
+		if seg.field != fieldLiteral {
+			return seg, 0, fmt.Errorf("unsupported verb after %q", s[:n])
+		}
+		return seg, 0, nil
+	}
+	if seg.field == fieldLiteral {
+		return seg, 0, fmt.Errorf("verb %%%s needs an argument index", s[:n+1])
+	}
+	switch seg.field {
+	case fieldTime:
+		seg.text = ""
+	case fieldShortPath:
+		seg.depth = DefaultShortPathDepth
+	}
+	return seg, n + 1, nil
+}
+
+// colorEscapes resolves the argument of %{color:arg}, the names of ansi.Controls
+// in any case or anything ansi.ParseColor accepts, downgraded to every ansi.Profile
+func colorEscapes(name string) []string {
+	esc := make([]string, ansi.TrueColor+1)
+	for k, c := range ansi.Controls {
+		if strings.EqualFold(k, name) {
+			for p := range esc {
+				esc[p] = c.Str
+			}
+			return esc
+		}
+	}
+	c, err := ansi.ParseColor(name)
+	if err != nil {
+		return nil
+	}
+	for p := range esc {
+		esc[p] = c.Downgrade(ansi.Profile(p)).Str
+	}
+	return esc
+}
+
+// timeLayout resolves the names in Formats ("rfc3339"...) to their layout
+func timeLayout(layout string) string {
+	if f, ok := Formats[layout]; ok {
+		return f._String
+	}
+	return layout
+}
+
+// append the entry rendered with the template to dst, %{time} without
+// a layout uses timeFormat and %{color} is only rendered for a profile other than NoColor
+func (t *template) append(dst []byte, r *info, timeFormat string, profile ansi.Profile) []byte {
+	for i := range t.segments {
+		seg := &t.segments[i]
+		switch seg.field {
+		case fieldLiteral:
+			dst = append(dst, seg.text...)
+			continue
+		case fieldColor:
+			if profile == ansi.NoColor {
+				continue
+			}
+			if seg.esc == nil {
+				dst = append(dst, Levels[r.Level].escapedBytes...)
+			} else {
+				dst = append(dst, seg.esc[profile]...)
+			}
+			continue
+		}
+		mark := len(dst)
+		switch seg.field {
+		case fieldID:
+			dst = append(dst, r.id[:r.idLen]...)
+		case fieldTime:
+			layout := seg.text
+			if layout == "" {
+				layout = timeFormat
+			}
+			dst = appendTime(dst, r.when, layout)
+		case fieldModule:
+			dst = append(dst, r.Module...)
+		case fieldFile:
+			dst = append(dst, r.Filename...)
+		case fieldLine:
+			dst = strconv.AppendInt(dst, int64(r.Line), 10)
+		case fieldLevel:
+			dst = append(dst, Levels[r.Level].Str...)
+		case fieldMessage:
+			dst = appendValue(dst, r.Message)
+		case fieldEmoji:
+			dst = append(dst, r.Emoji...)
+		case fieldFunc:
+			dst = append(dst, r.Func...)
+		case fieldPackage:
+			dst = append(dst, r.Package...)
+		case fieldPath:
+			dst = append(dst, r.Path...)
+		case fieldShortPath:
+			dst = append(dst, shortPath(r.Path, seg.depth)...)
+		case fieldFields:
+			dst = appendFields(dst, r.Fields)
+		}
+		if seg.prec >= 0 || seg.width != 0 {
+			dst = seg.pad(dst, mark)
+		}
+	}
+	return dst
+}
+
+// truncate to a number of characters and pad to a number of columns what was
+// appended to dst after mark, wide characters (emojis...) take two columns
+func (seg *segment) pad(dst []byte, mark int) []byte {
+	if seg.prec >= 0 {
+		n := 0
+		for i := mark; i < len(dst); n++ {
+			if n == seg.prec {
+				dst = dst[:i]
+				break
+			}
+			_, size := utf8.DecodeRune(dst[i:])
+			i += size
+		}
+	}
+	width := seg.width
+	if width < 0 {
+		width = -width
+	}
+	n := 0
+	if width > 0 {
+		n = ansi.WidthBytes(dst[mark:])
+	}
+	if n >= width {
+		return dst
+	}
+	fill := width - n
+	for i := 0; i < fill; i++ {
+		dst = append(dst, ' ')
+	}
+	if seg.width > 0 { // right aligned, move the value after the padding
+		copy(dst[mark+fill:], dst[mark:len(dst)-fill])
+		for i := mark; i < mark+fill; i++ {
+			dst[i] = ' '
+		}
+	}
+	return dst
+}
+
+// append a message without going through fmt for the common types
+func appendValue(dst []byte, v interface{}) []byte {
+	switch t := v.(type) {
+	case string:
+		return append(dst, t...)
+	case []byte:
+		return append(dst, t...)
+	case error:
+		return append(dst, t.Error()...)
+	case int:
+		return strconv.AppendInt(dst, int64(t), 10)
+	case nil:
+		return dst
+	default:
+		return append(dst, fmt.Sprint(v)...)
+	}
+}
@@ -0,0 +1,15 @@
+// COPYRIGHT (c) 2019-2021 SILVANO ZAMPARDI, ALL RIGHTS RESERVED.
+// The license for these sources can be found in the LICENSE file in the root directory of this source tree.
+
+//go:build !linux
+// +build !linux
+
+package log
+
+import "os"
+
+// isTerminal falls back to checking for a character device where we do not ioctl
+func isTerminal(f *os.File) bool {
+	fi, err := f.Stat()
+	return err == nil && fi.Mode()&os.ModeCharDevice != 0
+}
@@ -0,0 +1,43 @@
+// COPYRIGHT (c) 2019-2021 SILVANO ZAMPARDI, ALL RIGHTS RESERVED.
+// The license for these sources can be found in the LICENSE file in the root directory of this source tree.
+
+package unicode
+
+import (
+	"testing"
+)
+
+func TestEmojiNames(t *testing.T) {
+	if e := Emoji(":sob:"); e != CodepageIntToEmoji(128557) {
+		t.Errorf("Unexpected :sob: %q", e)
+	}
+	if e := Emoji("warning"); e != "⚠️" {
+		t.Errorf("Unexpected warning %q", e)
+	}
+	if e := Emoji(":flag_it:"); e != "🇮🇹" {
+		t.Errorf("Unexpected flag %q", e)
+	}
+	if e := Emoji(":antimatter:"); e != "" {
+		t.Errorf("Unexpected emoji for an unknown name %q", e)
+	}
+	for name, n := range names {
+		if ASCII(n.emoji) == n.emoji {
+			t.Errorf("No ASCII fallback for %s", name)
+		}
+	}
+}
+
+func TestSequences(t *testing.T) {
+	if e := Sequence(0x1f469, 0x200d, 0x1f4bb); e != Emoji(":woman_technologist:") {
+		t.Errorf("Unexpected sequence %q", e)
+	}
+	if e := SkinTone(Emoji(":thumbsup:"), 3); e != "👍🏽" {
+		t.Errorf("Unexpected skin tone %q", e)
+	}
+	if e := SkinTone(Emoji(":technologist:"), 1); e != "🧑🏻‍💻" {
+		t.Errorf("Unexpected skin tone in a sequence %q", e)
+	}
+	if e := Flag("i1"); e != "" {
+		t.Errorf("Unexpected flag %q", e)
+	}
+}
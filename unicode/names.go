@@ -0,0 +1,195 @@
+// COPYRIGHT (c) 2019-2021 SILVANO ZAMPARDI, ALL RIGHTS RESERVED.
+// The license for these sources can be found in the LICENSE file in the root directory of this source tree.
+
+package unicode
+
+import (
+	"os"
+	"strings"
+)
+
+// Sequence joiners and modifiers
+const (
+	ZWJ          = "\u200d" // zero width joiner, glues emojis into one (👩‍💻)
+	Presentation = "\ufe0f" // variation selector 16, asks for the emoji rendering of a character (⚠️)
+	skinTone     = 0x1f3fb  // first of the 5 Fitzpatrick modifiers
+	regionalA    = 0x1f1e6  // regional indicator A, flags are pairs of them
+)
+
+type named struct {
+	emoji string
+	ascii string // fallback for terminals without emojis
+}
+
+// names of the emojis, like the :shortcodes: of chat applications
+var names = map[string]named{
+	// faces
+	"sob":                {"😭", ":'("},
+	"rage":               {"😡", ">:("},
+	"triumph":            {"😤", ">:|"},
+	"smile":              {"😄", ":D"},
+	"yum":                {"😋", ":P"},
+	"confused":           {"😕", ":/"},
+	"grinning":           {"😀", ":D"},
+	"joy":                {"😂", ":'D"},
+	"wink":               {"😉", ";)"},
+	"thinking":           {"🤔", ":?"},
+	"neutral_face":       {"😐", ":|"},
+	"cry":                {"😢", ":'("},
+	"scream":             {"😱", ":O"},
+	"sleeping":           {"😴", "zZ"},
+	"skull":              {"💀", "x_x"},
+	"robot":              {"🤖", "[bot]"},
+	"ghost":              {"👻", "[boo]"},
+	"technologist":       {"🧑" + ZWJ + "💻", "[dev]"},
+	"woman_technologist": {"👩" + ZWJ + "💻", "[dev]"},
+	"man_technologist":   {"👨" + ZWJ + "💻", "[dev]"},
+	// hands
+	"thumbsup":    {"👍", "(+)"},
+	"thumbsdown":  {"👎", "(-)"},
+	"clap":        {"👏", "(clap)"},
+	"wave":        {"👋", "o/"},
+	"raised_hand": {"✋", "(stop)"},
+	"point_right": {"👉", "->"},
+	// symbols
+	"warning":                 {"⚠" + Presentation, "[!]"},
+	"fire":                    {"🔥", "[fire]"},
+	"boom":                    {"💥", "[boom]"},
+	"x":                       {"❌", "[x]"},
+	"heavy_check_mark":        {"✔" + Presentation, "[v]"},
+	"white_check_mark":        {"✅", "[v]"},
+	"no_entry":                {"⛔", "[-]"},
+	"rotating_light":          {"🚨", "[!!]"},
+	"bell":                    {"🔔", "[bell]"},
+	"information_source":      {"ℹ" + Presentation, "[i]"},
+	"question":                {"❓", "[?]"},
+	"exclamation":             {"❗", "[!]"},
+	"bangbang":                {"‼" + Presentation, "[!!]"},
+	"bulb":                    {"💡", "[*]"},
+	"bug":                     {"🐛", "[bug]"},
+	"mag":                     {"🔍", "[?]"},
+	"sparkles":                {"✨", "[*]"},
+	"star":                    {"⭐", "[*]"},
+	"zap":                     {"⚡", "[z]"},
+	"lock":                    {"🔒", "[lock]"},
+	"unlock":                  {"🔓", "[open]"},
+	"key":                     {"🔑", "[key]"},
+	"gear":                    {"⚙" + Presentation, "[cfg]"},
+	"wrench":                  {"🔧", "[fix]"},
+	"hammer":                  {"🔨", "[fix]"},
+	"package":                 {"📦", "[pkg]"},
+	"rocket":                  {"🚀", "[go]"},
+	"hourglass":               {"⌛", "[..]"},
+	"stopwatch":               {"⏱" + Presentation, "[t]"},
+	"memo":                    {"📝", "[note]"},
+	"floppy_disk":             {"💾", "[save]"},
+	"inbox_tray":              {"📥", "[in]"},
+	"outbox_tray":             {"📤", "[out]"},
+	"link":                    {"🔗", "[link]"},
+	"globe_with_meridians":    {"🌐", "[net]"},
+	"satellite":               {"📡", "[net]"},
+	"heart":                   {"❤" + Presentation, "<3"},
+	"broken_heart":            {"💔", "</3"},
+	"recycle":                 {"♻" + Presentation, "[~]"},
+	"arrows_counterclockwise": {"🔄", "[~]"},
+	"heavy_plus_sign":         {"➕", "[+]"},
+	"heavy_minus_sign":        {"➖", "[-]"},
+	"red_circle":              {"🔴", "(R)"},
+	"yellow_circle":           {"🟡", "(Y)"},
+	"green_circle":            {"🟢", "(G)"},
+	"blue_circle":             {"🔵", "(B)"},
+	"white_circle":            {"⚪", "( )"},
+	"black_circle":            {"⚫", "(*)"},
+	"rainbow_flag":            {"🏳" + Presentation + ZWJ + "🌈", "[flag]"},
+	"pirate_flag":             {"🏴" + ZWJ + "☠" + Presentation, "[flag]"},
+	"checkered_flag":          {"🏁", "[end]"},
+}
+
+var asciiOf = func() map[string]string {
+	m := make(map[string]string, len(names))
+	for _, n := range names {
+		if _, ok := m[n.emoji]; !ok {
+			m[n.emoji] = n.ascii
+		}
+	}
+	return m
+}()
+
+// Emoji returns the emoji with that name, colons are optional (":warning:" or "warning").
+// Flags are named after their ISO 3166 country code (":flag_it:"). Unknown names return ""
+func Emoji(name string) string {
+	name = strings.ToLower(strings.Trim(name, ":"))
+	if n, ok := names[name]; ok {
+		return n.emoji
+	}
+	if strings.HasPrefix(name, "flag_") {
+		return Flag(name[5:])
+	}
+	return ""
+}
+
+// Sequence joins codepoints, for emojis made of several of them (ZWJ sequences, skin tones...)
+func Sequence(codepoints ...int) string {
+	r := make([]rune, len(codepoints))
+	for i, c := range codepoints {
+		r[i] = rune(c)
+	}
+	return string(r)
+}
+
+// Flag returns the flag of a two letters ISO 3166 country code ("IT"), or "" for anything else
+func Flag(country string) string {
+	if len(country) != 2 {
+		return ""
+	}
+	var r [2]rune
+	for i, c := range strings.ToUpper(country) {
+		if c < 'A' || c > 'Z' {
+			return ""
+		}
+		r[i] = regionalA + c - 'A'
+	}
+	return string(r[:])
+}
+
+// SkinTone applies one of the 5 Fitzpatrick modifiers, 1 (lightest) to 5 (darkest),
+// to the first character of emoji. Other tones return emoji as it is
+func SkinTone(emoji string, tone int) string {
+	if tone < 1 || tone > 5 || emoji == "" {
+		return emoji
+	}
+	for i := range emoji {
+		if i > 0 {
+			return emoji[:i] + string(rune(skinTone+tone-1)) + emoji[i:]
+		}
+	}
+	return emoji + string(rune(skinTone+tone-1))
+}
+
+// ASCII returns a plain text replacement of a named emoji (":warning:" is "[!]"),
+// emoji is returned as it is when there is none
+func ASCII(emoji string) string {
+	if a, ok := asciiOf[emoji]; ok {
+		return a
+	}
+	return emoji
+}
+
+// Supported guesses whether the terminal can show emojis: the locale must be UTF-8
+// (LC_ALL, LC_CTYPE or LANG) and the terminal not a linux console, or it is a Windows Terminal
+func Supported() bool {
+	if os.Getenv("WT_SESSION") != "" { // Windows Terminal
+		return true
+	}
+	switch os.Getenv("TERM") {
+	case "linux", "dumb", "vt100", "vt220":
+		return false
+	}
+	for _, key := range []string{"LC_ALL", "LC_CTYPE", "LANG"} {
+		if v := os.Getenv(key); v != "" {
+			v = strings.ToLower(v)
+			return strings.Contains(v, "utf-8") || strings.Contains(v, "utf8")
+		}
+	}
+	return false
+}
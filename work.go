@@ -4,70 +4,75 @@
 package log
 
 import (
-	"bytes"
 	"encoding/json"
 	"fmt"
 	"io"
 	"log"
 	"os"
-	"path"
-	"runtime"
-	"strings"
+	"sync"
 	"sync/atomic"
-	"time"
 
 	"github.com/szampardi/msg/ansi"
 )
 
-// Worker class, Worker is a log object used to log messages and Color specifies
+// Worker class, Worker is a log object used to log messages and color specifies
 // if colored output is to be produced
 type worker struct {
+	seq        uint64 // the counter of IDCounter, accessed atomically, first to be 64 bit aligned
 	Minion     *log.Logger
-	Color      bool
-	spFormat   string
-	format     string
-	timeFormat string
-	level      Lvl
-}
-
-//NewWorker  Returns an instance of worker class, prefix is the string attached to every log,
-// flag determine the log params, color parameters verifies whether we need colored outputs or not
-func newWorker(prefix string, format, timeformat string, flag int, color bool, out io.Writer, lvl Lvl) *worker {
-	var spFormat string
-	if format == "" {
-		format = Formats[PlainFormat]._String
-	}
-	switch format {
-	case "yaml":
-		spFormat = "yaml"
-	case "json":
-		spFormat = "json"
-	}
-	if v, ok := Formats[format]; ok {
-		format = v._String
-	}
-	if timeformat == "" {
-		timeformat = time.RFC3339
+	colorMode  int32        // ColorMode, accessed atomically
+	color      uint32       // ansi.Profile of colorMode for the current output, NoColor for none, accessed atomically
+	formatter  atomic.Value // *formatter
+	level      int32        // Lvl of entries built, the highest of outLevel and the one of ring, accessed atomically
+	outLevel   int32        // Lvl of entries written to the output, accessed atomically
+	ring       atomic.Value // *RingBuffer
+	timeSource atomic.Value // *timeSource
+	idMode     int32        // IDMode, accessed atomically
+	settings   uint32       // incremented under mu when settings are applied together, accessed atomically
+	noCaller   uint32       // caller lookup disabled, accessed atomically
+	theme      atomic.Value // EmojiTheme
+	asciiEmoji uint32       // the output cannot show emojis, accessed atomically
+	entries    uint32       // the output is an EntryWriter, accessed atomically
+	direct     bool         // no prefix nor flags on Minion, write to its writer without copying
+	opened     io.Writer    // output opened by the package (MSG_OUTPUT), closed once replaced, under mu
+	mu         sync.Mutex   // serializes direct writes
+}
+
+// NewWorker  Returns an instance of worker class, prefix is the string attached to every log,
+// flag determine the log params, color parameters verifies whether we need colored outputs or not.
+// An invalid format falls back to the plain one
+func newWorker(prefix string, format, timeformat string, flag int, color ColorMode, out io.Writer, lvl Lvl) *worker {
+	f, err := newFormatter(format, timeformat)
+	if err != nil {
+		f, _ = newFormatter(PlainFormat, timeformat)
 	}
+	return newFormattedWorker(prefix, f, flag, color, out, lvl)
+}
+
+func newFormattedWorker(prefix string, f *formatter, flag int, color ColorMode, out io.Writer, lvl Lvl) *worker {
 	if out == nil {
 		out = os.Stdout
 	}
-	return &worker{
-		Minion:     log.New(out, prefix, flag),
-		Color:      color,
-		spFormat:   spFormat,
-		format:     format,
-		timeFormat: timeformat,
-		level:      lvl,
+	w := &worker{
+		Minion: log.New(out, prefix, flag),
+		direct: prefix == "" && flag == 0,
+	}
+	w.setLogLevel(lvl)
+	if loc := getDefaultFormats().loc; loc != nil {
+		w.setLocation(loc)
 	}
+	w.setColor(color, out)
+	w.inspectOutput(out)
+	w.setFormat(f)
+	return w
 }
 
 // New Returns a new instance of logger class, module is the specific module for which we are logging
-// , color defines whether the output is to be colored or not, out is instance of type io.Writer defaults
-// to os.Stderr
+// , color defines whether the output is to be colored or not (a bool or a ColorMode, ColorAuto by default),
+// out is instance of type io.Writer defaults to os.Stderr
 func New(format, timeformat string, args ...interface{}) (Logger, error) {
 	var module string = "msg"
-	var color bool = true
+	var color ColorMode = ColorAuto
 	var out io.Writer = os.Stderr
 	var level Lvl = LDefault
 	for _, arg := range args {
@@ -75,27 +80,39 @@ func New(format, timeformat string, args ...interface{}) (Logger, error) {
 		case string:
 			module = t
 		case bool:
+			color = ColorNever
+			if t {
+				color = ColorAlways
+			}
+		case ColorMode:
 			color = t
 		case io.Writer:
 			out = t
 		case Lvl:
 			level = t
 		default:
-			return *defaultLogger, fmt.Errorf("%s:\t%s", "invalid argument", t)
+			return *Default(), fmt.Errorf("%s:\t%s", "invalid argument", t)
 		}
 	}
+	f, err := newFormatter(format, timeformat)
+	if err != nil {
+		return *Default(), err
+	}
 	//newWorker.setLogLevel(level)
 	return Logger{
 		Module: module,
-		worker: newWorker("", format, timeformat, 0, color, out, level),
+		worker: newFormattedWorker("", f, 0, color, out, level),
 	}, nil
 }
 
 // Logger class that is an interface to user to log messages, Module is the module for which we are testing
 // worker is variable of Worker class that is used in bottom layers to log the message
 type Logger struct {
-	Module string
-	worker *worker
+	Module      string
+	worker      *worker
+	callerSkip  int
+	fields      Fields
+	detectLevel bool
 }
 
 // Output ...
@@ -103,59 +120,268 @@ func (l *Logger) Output(calldepth int, s string) error {
 	return l.worker.Minion.Output(calldepth, s)
 }
 
-// SetOutput ...
+// SetOutput changes the writer of the Logger, with ColorAuto colors are re-evaluated for w,
+// as is the support of emojis. A file opened for MSG_OUTPUT is closed
 func (l *Logger) SetOutput(w io.Writer) {
-	l.worker.Minion.SetOutput(w)
+	l.worker.setOutput(w)
 }
 
-//Log  The log commnand is the function available to user to log message, lvl specifies
-// the degree of the message the user wants to log, message is the info user wants to log
+// OutputWriter returns the writer of the Logger, see Writer to write lines to the Logger
+func (l *Logger) OutputWriter() io.Writer {
+	l.worker.mu.Lock()
+	defer l.worker.mu.Unlock()
+	return l.worker.Minion.Writer()
+}
+
+// apply settings at once: an entry is written with the old ones or the new ones. The
+// replaced output is returned, nil when it is kept. Levels apply to the entries logged afterwards
+func (w *worker) apply(s *loggerSettings) io.Writer {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.setFormat(s.formatter)
+	w.storeLocation(s.loc)
+	w.setLogLevel(s.level)
+	var old io.Writer
+	out := w.Minion.Writer()
+	if s.out != nil && s.out != out {
+		old = out
+		w.Minion.SetOutput(s.out)
+		out = s.out
+	}
+	w.inspectOutput(out)
+	w.setColor(s.color, out)
+	atomic.AddUint32(&w.settings, 1)
+	return old
+}
+
+// the settings of w, to apply them back
+func (w *worker) current() *loggerSettings {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return &loggerSettings{
+		level:     Lvl(atomic.LoadInt32(&w.outLevel)),
+		color:     ColorMode(atomic.LoadInt32(&w.colorMode)),
+		formatter: w.getFormat(),
+		loc:       w.getTimeSource().loc,
+		out:       w.Minion.Writer(),
+	}
+}
+
+// setOutput replaces the output, returning the previous one. If the package opened
+// it, it is closed
+func (w *worker) setOutput(out io.Writer) io.Writer {
+	w.mu.Lock()
+	old := w.Minion.Writer()
+	w.Minion.SetOutput(out)
+	var opened io.Writer
+	if w.opened != nil && w.opened == old && out != old {
+		opened, w.opened = old, nil
+	}
+	w.mu.Unlock()
+	if opened != nil {
+		closeOutput(opened)
+	}
+	if ColorMode(atomic.LoadInt32(&w.colorMode)) == ColorAuto {
+		w.setColor(ColorAuto, out)
+	}
+	w.inspectOutput(out)
+	return old
+}
+
+// setOpenedOutput replaces the output with one the package opened, to be closed when replaced
+func (w *worker) setOpenedOutput(out io.Writer) {
+	w.setOutput(out)
+	w.mu.Lock()
+	w.opened = out
+	w.mu.Unlock()
+}
+
+// what the worker needs to know about its output, besides colors
+func (w *worker) inspectOutput(out io.Writer) {
+	w.checkEmoji(out)
+	var entries uint32
+	if _, ok := out.(EntryWriter); ok {
+		entries = 1
+	}
+	atomic.StoreUint32(&w.entries, entries)
+}
+
+// Log  The log commnand is the function available to user to log message, lvl specifies
+// the degree of the message the user wants to log, message is the info user wants to log.
+// A func() string, LogValuer or fmt.Stringer message is only evaluated if lvl is enabled
 func (l *Logger) Log(lvl Lvl, message interface{}) {
-	l.logInternal(lvl, message, 2)
+	if l.worker.enabled(lvl) {
+		l.logInternal(lvl, message, 2)
+	}
 }
 
-//Log  The log commnand is the function available to user to log message, lvl specifies
+// Log  The log commnand is the function available to user to log message, lvl specifies
 // the degree of the message the user wants to log, message is the info user wants to log
 func Log(lvl Lvl, message string) {
-	defaultLogger.logInternal(lvl, message, 2)
+	if l := Default(); l.worker.enabled(lvl) {
+		l.logInternal(lvl, message, 2)
+	}
+}
+
+// Enabled reports whether entries at lvl would be logged or recorded by a RingBuffer,
+// to guard blocks of code that only exist to build log messages
+func (l *Logger) Enabled(lvl Lvl) bool {
+	return l.worker.enabled(lvl)
+}
+
+// Enabled reports whether the default Logger would log entries at lvl
+func Enabled(lvl Lvl) bool {
+	return Default().worker.enabled(lvl)
+}
+
+// enabled is the only work done for filtered out entries: callers check it
+// before building their message so a disabled level costs one atomic load
+func (w *worker) enabled(lvl Lvl) bool {
+	return lvl <= Lvl(atomic.LoadInt32(&w.level))
+}
+
+var (
+	infoPool = sync.Pool{New: func() interface{} { return new(info) }}
+	bufPool  = sync.Pool{New: func() interface{} { return new(buffer) }}
+)
+
+// buffer is a pooled byte slice, it is an io.Writer for the encoders that need one
+type buffer []byte
+
+func (b *buffer) Write(p []byte) (int, error) {
+	*b = append(*b, p...)
+	return len(p), nil
 }
 
+// buffers grown past this (stack dumps...) are left to the GC instead of pooled
+const maxPooledBuffer = 1 << 16
+
 func (l *Logger) logInternal(lvl Lvl, message interface{}, pos int) {
 	//var formatString string = "#%d %s [%s] %s:%d ▶ %.3s %s"
-	_, filename, line, _ := runtime.Caller(pos)
-	filename = path.Base(filename)
-	info := &info{
-		ID:       atomic.AddUint32(&logNo, 1),
-		Time:     time.Now().Format(l.worker.timeFormat),
-		Module:   l.Module,
-		Filename: filename,
-		Line:     line,
-		Level:    lvl,
-		Message:  message,
-		//format:   formatString,
-	}
-	l.worker.log(lvl, 2, info)
-}
-
-// Log is Function of Worker class to log a string based on level
-func (w *worker) log(level Lvl, calldepth int, info *info) error {
-	if w.level < level {
-		return nil
-	}
-	if w.Color {
-		buf := &bytes.Buffer{}
-		buf.Write(Levels[level].escapedBytes)
-		buf.Write([]byte(info.output(w.format, w.spFormat)))
-		buf.Write(ansi.Controls["Reset"].Bytes)
-		return w.Minion.Output(calldepth+1, buf.String())
-	}
-	return w.Minion.Output(calldepth+1, info.output(w.format, w.spFormat))
-}
-
-// Output Returns formatted string
-func (r *info) output(format, spFormat string) string {
-	var out string
-	switch spFormat {
+	// taken before the format and the time, an apply after it makes write render again
+	settings := atomic.LoadUint32(&l.worker.settings)
+	f := l.worker.getFormat()
+	info := infoPool.Get().(*info)
+	info.when = l.worker.now()
+	l.worker.nextID(info)
+	info.Module = l.Module
+	info.Level = lvl
+	info.Emoji = l.worker.emoji(lvl)
+	info.Message = evaluate(message)
+	info.Fields = l.fields
+	if atomic.LoadUint32(&l.worker.noCaller) == 0 && (f.tmpl.needsCaller || f.spFormat != "" || atomic.LoadUint32(&l.worker.entries) == 1) {
+		info.resolveCaller(pos + l.callerSkip)
+	}
+	if r := l.worker.ringBuffer(); r != nil {
+		shown := lvl <= Lvl(atomic.LoadInt32(&l.worker.outLevel))
+		if lvl <= r.level {
+			r.add(info.entry(), shown, l.worker)
+		}
+		if shown && r.triggered(lvl) {
+			l.worker.flushRing(r, f, settings)
+		}
+		if shown {
+			l.worker.log(lvl, 2, f, info, settings)
+		}
+	} else {
+		l.worker.log(lvl, 2, f, info, settings)
+	}
+	*info = infoZero
+	infoPool.Put(info)
+}
+
+var infoZero info
+
+// LogValuer is implemented by messages that are expensive to build: LogValue is
+// only called once the entry is known to be logged
+type LogValuer interface {
+	LogValue() interface{}
+}
+
+// resolve deferred messages, they are evaluated at most once per entry
+func evaluate(message interface{}) interface{} {
+	for i := 0; i < 8; i++ { // bounded, a LogValuer may return another one
+		switch t := message.(type) {
+		case func() string:
+			return t()
+		case LogValuer:
+			message = t.LogValue()
+		case fmt.Stringer:
+			return t.String()
+		default:
+			return message
+		}
+	}
+	return message
+}
+
+// Log is Function of Worker class to log a string based on level, f and info were
+// made with the settings generation given
+func (w *worker) log(level Lvl, calldepth int, f *formatter, info *info, settings uint32) error {
+	buf := bufPool.Get().(*buffer)
+	defer func() {
+		if cap(*buf) <= maxPooledBuffer {
+			*buf = (*buf)[:0]
+			bufPool.Put(buf)
+		}
+	}()
+	w.render(buf, level, f, info)
+	if !w.direct && atomic.LoadUint32(&w.entries) == 0 {
+		return w.Minion.Output(calldepth+1, string(*buf))
+	}
+	out, e, err := w.write(level, info, buf, settings)
+	// hooks run unlocked, they may log to this Logger
+	if h, ok := out.(hookRunner); ok && e != nil {
+		h.runHooks(e)
+	}
+	return err
+}
+
+// render the entry in buf, as a line
+func (w *worker) render(buf *buffer, level Lvl, f *formatter, info *info) {
+	switch profile := w.profile(); {
+	case profile == ansi.NoColor:
+		info.output(buf, f, ansi.NoColor)
+	case f.tmpl.colored && f.spFormat == "":
+		// the format places its own colors, just make sure they do not bleed
+		info.output(buf, f, profile)
+		*buf = append(*buf, ansi.Controls["Reset"].Bytes...)
+	default:
+		*buf = append(*buf, Levels[level].escapedBytes...)
+		info.output(buf, f, ansi.NoColor)
+		*buf = append(*buf, ansi.Controls["Reset"].Bytes...)
+	}
+	if b := *buf; len(b) == 0 || b[len(b)-1] != '\n' {
+		*buf = append(*buf, '\n')
+	}
+}
+
+// write buf to the output, as an entry if it wants them. The output is only replaced
+// under mu, it is not closed while in use. If settings were applied since buf was
+// rendered, it is rendered again: an entry never mixes old and new settings
+func (w *worker) write(level Lvl, info *info, buf *buffer, settings uint32) (io.Writer, *Entry, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if atomic.LoadUint32(&w.settings) != settings {
+		info.when = w.inLocation(info.when)
+		*buf = (*buf)[:0]
+		w.render(buf, level, w.getFormat(), info)
+	}
+	p := *buf
+	out := w.Minion.Writer()
+	if ew, ok := out.(EntryWriter); ok {
+		e := info.entry()
+		_, err := ew.WriteEntry(&e, p)
+		return out, &e, err
+	}
+	_, err := out.Write(p)
+	return out, nil, err
+}
+
+// Output appends the formatted entry to buf, %{color} directives are rendered for
+// profile unless it is NoColor
+func (r *info) output(buf *buffer, f *formatter, profile ansi.Profile) {
+	switch f.spFormat {
 	/*
 		case "yaml":
 			l := &info{
@@ -182,24 +408,21 @@ func (r *info) output(format, spFormat string) string {
 				r.Message = imported
 			}
 		}
-		bout, _ := json.Marshal(r)
-		out = string(bout)
-	default:
-		out = fmt.Sprintf(
-			format,
-			r.ID,                  // %[1] // %{id}
-			r.Time,                // %[2] // %{time[:fmt]}
-			r.Module,              // %[3] // %{module}
-			r.Filename,            // %[4] // %{filename}
-			r.Line,                // %[5] // %{line}
-			Levels[r.Level].Str,   // %[6] // %{level}
-			r.Message,             // %[7] // %{message}
-			Levels[r.Level].emoji, // %[8] // %{emoji}
-		)
-		// Ignore printf errors if len(args) > len(verbs)
-		if i := strings.LastIndex(out, "%!(EXTRA"); i != -1 {
-			return out[:i]
+		switch {
+		case r.idLen == ulidLen:
+			r.ID = string(r.id[:r.idLen])
+		case r.idLen > 0:
+			r.ID = json.Number(r.id[:r.idLen])
+		}
+		if n, ok := unixTime(r.when, f.timeFormat); ok {
+			r.Time = n
+		} else {
+			r.Time = r.when.Format(f.timeFormat)
 		}
+		if err := json.NewEncoder(buf).Encode(r); err == nil {
+			*buf = (*buf)[:len(*buf)-1] // Encode terminates with a newline
+		}
+	default:
+		*buf = f.tmpl.append(*buf, r, f.timeFormat, profile)
 	}
-	return out
 }
@@ -0,0 +1,88 @@
+// COPYRIGHT (c) 2019-2021 SILVANO ZAMPARDI, ALL RIGHTS RESERVED.
+// The license for these sources can be found in the LICENSE file in the root directory of this source tree.
+
+package log
+
+import (
+	"bytes"
+	"io"
+	"sync"
+)
+
+// MaxLineLength is the longest entry made by the writers of Logger.Writer,
+// longer lines are logged in chunks of this size
+const MaxLineLength = 64 << 10
+
+// Writer returns a writer logging every line written to it as an entry at lvl,
+// to pipe the output of a subprocess in the Logger for example. Partial lines
+// are kept until they are complete or the writer is closed. With
+// WithLevelDetection, the level is taken from leading tokens like "ERROR:"
+func (l *Logger) Writer(lvl Lvl) io.WriteCloser {
+	return &lineWriter{l: l, lvl: lvl}
+}
+
+type lineWriter struct {
+	l      *Logger
+	lvl    Lvl
+	mu     sync.Mutex
+	buf    []byte
+	closed bool
+}
+
+func (w *lineWriter) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.closed {
+		return 0, ErrClosed
+	}
+	n := len(p)
+	for len(p) > 0 {
+		i := bytes.IndexByte(p, '\n')
+		if i == -1 {
+			w.buf = append(w.buf, p...)
+			for len(w.buf) >= MaxLineLength {
+				w.emit(w.buf[:MaxLineLength])
+				w.buf = append(w.buf[:0], w.buf[MaxLineLength:]...)
+			}
+			break
+		}
+		line := p[:i]
+		if len(w.buf) > 0 {
+			w.buf = append(w.buf, line...)
+			line = w.buf
+		}
+		for len(line) > MaxLineLength {
+			w.emit(line[:MaxLineLength])
+			line = line[MaxLineLength:]
+		}
+		w.emit(bytes.TrimSuffix(line, []byte{'\r'}))
+		w.buf = w.buf[:0]
+		p = p[i+1:]
+	}
+	return n, nil
+}
+
+// Close logs what is left of the last line
+func (w *lineWriter) Close() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.closed {
+		return nil
+	}
+	w.closed = true
+	if len(w.buf) > 0 {
+		w.emit(bytes.TrimSuffix(w.buf, []byte{'\r'}))
+		w.buf = nil
+	}
+	return nil
+}
+
+func (w *lineWriter) emit(line []byte) {
+	lvl, message := w.lvl, string(line)
+	if w.l.detectLevel {
+		lvl, message = detectLevel(message, lvl)
+	}
+	if w.l.worker.enabled(lvl) {
+		w.l.logInternal(lvl, message, 3)
+	}
+}